@@ -6,7 +6,8 @@ require (
 	github.com/0chain/gosdk v0.0.0
 	github.com/btcsuite/btcd v0.22.0-beta // indirect
 	github.com/deckarep/golang-set v1.7.1 // indirect
-	github.com/h2non/filetype v1.1.1 // indirect
+	github.com/ethereum/go-ethereum v1.10.3
+	github.com/h2non/filetype v1.1.1
 	github.com/herumi/bls v0.0.0-20210511012341-3f3850a6eac7
 	github.com/klauspost/cpuid/v2 v2.0.6 // indirect
 	github.com/klauspost/reedsolomon v1.9.12 // indirect
@@ -15,9 +16,7 @@ require (
 	go.uber.org/atomic v1.8.0 // indirect
 	go.uber.org/multierr v1.7.0 // indirect
 	go.uber.org/zap v1.17.0 // indirect
-	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e // indirect
-	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4 // indirect
-	golang.org/x/sys v0.0.0-20210616094352-59db8d763f22 // indirect
+	golang.org/x/image v0.18.0
 )
 
 // temporary, for development
@@ -3,6 +3,8 @@ package zbox
 import (
 	"encoding/json"
 	"fmt"
+	"path"
+	"strings"
 
 	"github.com/0chain/gosdk/zboxcore/blockchain"
 	"github.com/0chain/gosdk/zboxcore/fileref"
@@ -24,6 +26,26 @@ type Allocation struct {
 
 	blobbers      []*blockchain.StorageNode
 	sdkAllocation *sdk.Allocation
+	// files replaces sdk allocation in versions and trash, set by tests
+	files remoteFiles
+}
+
+// remoteFiles - sdk file operations versions and trash are built from, sdk allocation implements it
+type remoteFiles interface {
+	GetFileMeta(path string) (*sdk.ConsolidatedFileMeta, error)
+	ListDir(path string) (*sdk.ListResult, error)
+	CreateDir(dirName string) error
+	CopyObject(path string, destPath string) error
+	MoveObject(path string, destPath string) error
+	RenameObject(path string, destName string) error
+	DeleteFile(path string) error
+}
+
+func (a *Allocation) remote() remoteFiles {
+	if a.files != nil {
+		return a.files
+	}
+	return a.sdkAllocation
 }
 
 // MinMaxCost - keeps cost for allocation update/creation
@@ -40,6 +62,7 @@ func (a *Allocation) ListDir(path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	withoutHidden(listResult)
 	retBytes, err := json.Marshal(listResult)
 	if err != nil {
 		return "", err
@@ -47,6 +70,30 @@ func (a *Allocation) ListDir(path string) (string, error) {
 	return string(retBytes), nil
 }
 
+// hiddenRoots - allocation root dirs kept by the SDK itself, they're left out of listings and directory transfers
+var hiddenRoots = []string{versionsRoot, trashRoot, compressionRoot}
+
+func isHiddenPath(remotePath string) bool {
+	remotePath = path.Clean("/" + remotePath)
+	for _, root := range hiddenRoots {
+		if remotePath == root || strings.HasPrefix(remotePath, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutHidden drops hidden dirs from listing
+func withoutHidden(listResult *sdk.ListResult) {
+	children := listResult.Children[:0]
+	for _, child := range listResult.Children {
+		if !isHiddenPath(child.Path) {
+			children = append(children, child)
+		}
+	}
+	listResult.Children = children
+}
+
 // ListDirFromAuthTicket - listing files from path with auth ticket
 func (a *Allocation) ListDirFromAuthTicket(authTicket string, lookupHash string) (string, error) {
 	listResult, err := a.sdkAllocation.ListDirFromAuthTicket(authTicket, lookupHash)
@@ -86,126 +133,251 @@ func (a *Allocation) GetFileMetaFromAuthTicket(authTicket string, lookupHash str
 	return string(retBytes), nil
 }
 
-// DownloadFile - start download file from remote path to localpath
-func (a *Allocation) DownloadFile(remotePath, localPath string, statusCb StatusCallback) error {
-	return a.sdkAllocation.DownloadFile(localPath, remotePath, statusCb)
+// remoteFileMeta returns meta of remote file, nil when it doesn't exist. Sdk reports the same error
+// for missing file and unreachable blobbers, so missing file is confirmed by listing of its nearest listed parent.
+func (a *Allocation) remoteFileMeta(remotePath string) (*sdk.ConsolidatedFileMeta, error) {
+	fileMeta, err := a.sdkAllocation.GetFileMeta(remotePath)
+	if err == nil {
+		return fileMeta, nil
+	}
+	child := path.Clean(remotePath)
+	for child != "/" {
+		parent := path.Dir(child)
+		list, lerr := a.sdkAllocation.ListDir(parent)
+		// failed listing is empty, missing parent is checked in its own parent
+		if lerr == nil && len(list.Path) > 0 {
+			for _, c := range list.Children {
+				if c.Name == path.Base(child) {
+					return nil, err
+				}
+			}
+			return nil, nil
+		}
+		child = parent
+	}
+	return nil, err
+}
+
+// DownloadFile - start download file from remote path to localpath, compressed file is decompressed
+func (a *Allocation) DownloadFile(remotePath, localPath string, statusCb StatusCallback) (*Operation, error) {
+	op := a.newDownloadOperation(remotePath, localPath, statusCb)
+	return op.start(func() error {
+		return a.sdkAllocation.DownloadFile(localPath, remotePath, &decompressStatus{StatusCallback: op, a: a, localPath: localPath})
+	})
+}
+
+// DownloadFileByBlock - start download file from remote path to localpath by blocks number.
+// Blocks of compressed file are blocks of its decompressed content.
+func (a *Allocation) DownloadFileByBlock(remotePath, localPath string, startBlock, endBlock int64, numBlocks int, statusCb StatusCallback) (*Operation, error) {
+	op := a.newDownloadOperation(remotePath, localPath, statusCb)
+	return op.start(func() error {
+		go a.downloadFileByBlock(remotePath, localPath, startBlock, endBlock, numBlocks, op)
+		return nil
+	})
 }
 
-// DownloadFileByBlock - start download file from remote path to localpath by blocks number
-func (a *Allocation) DownloadFileByBlock(remotePath, localPath string, startBlock, endBlock int64, numBlocks int, statusCb StatusCallback) error {
-	return a.sdkAllocation.DownloadFileByBlock(localPath, remotePath, startBlock, endBlock, numBlocks, statusCb)
+// downloadFileByBlock looks up compression record of the file before the download is started
+func (a *Allocation) downloadFileByBlock(remotePath, localPath string, startBlock, endBlock int64, numBlocks int, op *Operation) {
+	fileMeta, err := a.sdkAllocation.GetFileMeta(remotePath)
+	var r *compressionRecord
+	if err == nil {
+		r, err = a.compressionRecord(fileMeta.Hash)
+	}
+	if err == nil && r == nil {
+		err = a.sdkAllocation.DownloadFileByBlock(localPath, remotePath, startBlock, endBlock, numBlocks, op)
+	}
+	if err != nil {
+		op.Error(a.ID, remotePath, sdk.OpDownload, err)
+		return
+	}
+	if r != nil {
+		a.downloadCompressedBlocks(fileMeta, r, localPath, startBlock, endBlock, op)
+	}
 }
 
 // DownloadThumbnail - start download file thumbnail from remote path to localpath
-func (a *Allocation) DownloadThumbnail(remotePath, localPath string, statusCb StatusCallback) error {
-	return a.sdkAllocation.DownloadThumbnail(localPath, remotePath, statusCb)
+func (a *Allocation) DownloadThumbnail(remotePath, localPath string, statusCb StatusCallback) (*Operation, error) {
+	op := a.newDownloadOperation(remotePath, localPath, statusCb)
+	return op.start(func() error {
+		return a.sdkAllocation.DownloadThumbnail(localPath, remotePath, op)
+	})
+}
+
+// newCancellableOperation registers operation stopped by cancel, it has to be started with op.start.
+// Sdk cancels transfers by path, so operations with the same cancel key run one by one in start order.
+// Paused transfer started again keeps its operation.
+func (a *Allocation) newCancellableOperation(opType, localPath, remotePath, cancelKey string, cancel func() error, statusCb StatusCallback) *Operation {
+	cancelKey = a.ID + ":" + cancelKey
+	if op := operations.paused(cancelKey, opType, localPath, remotePath); op != nil {
+		op.mu.Lock()
+		op.next = statusCb
+		op.cancel = cancel
+		op.pause = nil
+		op.mu.Unlock()
+		return op
+	}
+	op := a.newOperation(opType, localPath, remotePath, statusCb)
+	op.cancelKey = cancelKey
+	op.cancel = cancel
+	return op
+}
+
+func (a *Allocation) newDownloadOperation(remotePath, localPath string, statusCb StatusCallback) *Operation {
+	op := a.newCancellableOperation(OpTypeDownload, localPath, remotePath, "download:"+remotePath, func() error {
+		return a.sdkAllocation.CancelDownload(remotePath)
+	}, statusCb)
+	return op
+}
+
+func (a *Allocation) newUploadOperation(localPath, remotePath string, statusCb StatusCallback) *Operation {
+	op := a.newCancellableOperation(OpTypeUpload, localPath, remotePath, "upload:"+localPath, func() error {
+		return a.sdkAllocation.CancelUpload(localPath)
+	}, statusCb)
+	return op
 }
 
 // UploadFile - start upload file thumbnail from localpath to remote path
-func (a *Allocation) UploadFile(workdir, localPath, remotePath, fileAttrs string, statusCb StatusCallback) error {
+func (a *Allocation) UploadFile(workdir, localPath, remotePath, fileAttrs string, statusCb StatusCallback) (*Operation, error) {
 	var attrs fileref.Attributes
 	if len(fileAttrs) > 0 {
 		err := json.Unmarshal([]byte(fileAttrs), &attrs)
 		if err != nil {
-			return fmt.Errorf("failed to convert fileAttrs. %v", err)
+			return nil, fmt.Errorf("failed to convert fileAttrs. %v", err)
 		}
 	}
 
-	return a.sdkAllocation.StartChunkedUpload(workdir, localPath, remotePath, statusCb, false, "", false, attrs)
+	op := a.newUploadOperation(localPath, remotePath, statusCb)
+	return op.start(func() error {
+		tracker, err := a.trackUpload(workdir, localPath, remotePath, fileAttrs, "", op, statusCb)
+		if err != nil {
+			return err
+		}
+		return a.sdkAllocation.StartChunkedUpload(workdir, localPath, remotePath, tracker, false, "", false, attrs)
+	})
 }
 
 // RepairFile - repairing file if it's exist in remote path
-func (a *Allocation) RepairFile(localPath, remotePath string, statusCb StatusCallback) error {
-	return a.sdkAllocation.RepairFile(localPath, remotePath, statusCb)
+func (a *Allocation) RepairFile(localPath, remotePath string, statusCb StatusCallback) (*Operation, error) {
+	op := a.newCancellableOperation(OpTypeRepair, localPath, remotePath, "upload:"+localPath, func() error {
+		return a.sdkAllocation.CancelUpload(localPath)
+	}, statusCb)
+	return op.start(func() error {
+		return a.sdkAllocation.RepairFile(localPath, remotePath, op)
+	})
 }
 
 // UploadFileWithThumbnail - start upload file with thumbnail
-func (a *Allocation) UploadFileWithThumbnail(localPath, remotePath, fileAttrs string, thumbnailpath string, statusCb StatusCallback) error {
+func (a *Allocation) UploadFileWithThumbnail(localPath, remotePath, fileAttrs string, thumbnailpath string, statusCb StatusCallback) (*Operation, error) {
 	var attrs fileref.Attributes
 	if len(fileAttrs) > 0 {
 		err := json.Unmarshal([]byte(fileAttrs), &attrs)
 		if err != nil {
-			return fmt.Errorf("failed to convert fileAttrs. %v", err)
+			return nil, fmt.Errorf("failed to convert fileAttrs. %v", err)
 		}
 	}
-	return a.sdkAllocation.UploadFileWithThumbnail(localPath, remotePath, thumbnailpath, attrs, statusCb)
+	op := a.newUploadOperation(localPath, remotePath, statusCb)
+	return op.start(func() error {
+		return a.sdkAllocation.UploadFileWithThumbnail(localPath, remotePath, thumbnailpath, attrs, op)
+	})
 }
 
 // EncryptAndUploadFile - start upload encrypted file
-func (a *Allocation) EncryptAndUploadFile(localPath, remotePath, fileAttrs string, statusCb StatusCallback) error {
+func (a *Allocation) EncryptAndUploadFile(localPath, remotePath, fileAttrs string, statusCb StatusCallback) (*Operation, error) {
 	var attrs fileref.Attributes
 	if len(fileAttrs) > 0 {
 		err := json.Unmarshal([]byte(fileAttrs), &attrs)
 		if err != nil {
-			return fmt.Errorf("failed to convert fileAttrs. %v", err)
+			return nil, fmt.Errorf("failed to convert fileAttrs. %v", err)
 		}
 	}
-	return a.sdkAllocation.EncryptAndUploadFile(localPath, remotePath, attrs, statusCb)
+	op := a.newUploadOperation(localPath, remotePath, statusCb)
+	return op.start(func() error {
+		return a.sdkAllocation.EncryptAndUploadFile(localPath, remotePath, attrs, op)
+	})
 }
 
 // EncryptAndUploadFileWithThumbnail - start upload encrypted file with thumbnail
-func (a *Allocation) EncryptAndUploadFileWithThumbnail(localPath, remotePath, fileAttrs string, thumbnailpath string, statusCb StatusCallback) error {
+func (a *Allocation) EncryptAndUploadFileWithThumbnail(localPath, remotePath, fileAttrs string, thumbnailpath string, statusCb StatusCallback) (*Operation, error) {
 	var attrs fileref.Attributes
 	if len(fileAttrs) > 0 {
 		err := json.Unmarshal([]byte(fileAttrs), &attrs)
 		if err != nil {
-			return fmt.Errorf("failed to convert fileAttrs. %v", err)
+			return nil, fmt.Errorf("failed to convert fileAttrs. %v", err)
 		}
 	}
-	return a.sdkAllocation.EncryptAndUploadFileWithThumbnail(localPath, remotePath, thumbnailpath, attrs, statusCb)
+	op := a.newUploadOperation(localPath, remotePath, statusCb)
+	return op.start(func() error {
+		return a.sdkAllocation.EncryptAndUploadFileWithThumbnail(localPath, remotePath, thumbnailpath, attrs, op)
+	})
 }
 
 // UpdateFile - update file from local path to remote path
-func (a *Allocation) UpdateFile(localPath, remotePath, fileAttrs string, statusCb StatusCallback) error {
+func (a *Allocation) UpdateFile(localPath, remotePath, fileAttrs string, statusCb StatusCallback) (*Operation, error) {
 	var attrs fileref.Attributes
 	if len(fileAttrs) > 0 {
 		err := json.Unmarshal([]byte(fileAttrs), &attrs)
 		if err != nil {
-			return fmt.Errorf("failed to convert fileAttrs. %v", err)
+			return nil, fmt.Errorf("failed to convert fileAttrs. %v", err)
 		}
 	}
-	return a.sdkAllocation.UpdateFile(localPath, remotePath, attrs, statusCb)
+	op := a.newUploadOperation(localPath, remotePath, statusCb)
+	return op.start(func() error {
+		return a.sdkAllocation.UpdateFile(localPath, remotePath, attrs, a.versionedUpdate(localPath, remotePath, op))
+	})
 }
 
 // UpdateFileWithThumbnail - update file from local path to remote path with Thumbnail
-func (a *Allocation) UpdateFileWithThumbnail(localPath, remotePath, fileAttrs string, thumbnailpath string, statusCb StatusCallback) error {
+func (a *Allocation) UpdateFileWithThumbnail(localPath, remotePath, fileAttrs string, thumbnailpath string, statusCb StatusCallback) (*Operation, error) {
 	var attrs fileref.Attributes
 	if len(fileAttrs) > 0 {
 		err := json.Unmarshal([]byte(fileAttrs), &attrs)
 		if err != nil {
-			return fmt.Errorf("failed to convert fileAttrs. %v", err)
+			return nil, fmt.Errorf("failed to convert fileAttrs. %v", err)
 		}
 	}
-	return a.sdkAllocation.UpdateFileWithThumbnail(localPath, remotePath, thumbnailpath, attrs, statusCb)
+	op := a.newUploadOperation(localPath, remotePath, statusCb)
+	return op.start(func() error {
+		return a.sdkAllocation.UpdateFileWithThumbnail(localPath, remotePath, thumbnailpath, attrs, a.versionedUpdate(localPath, remotePath, op))
+	})
 }
 
 // EncryptAndUpdateFile - update file from local path to remote path from encrypted folder
-func (a *Allocation) EncryptAndUpdateFile(localPath, remotePath, fileAttrs string, statusCb StatusCallback) error {
+func (a *Allocation) EncryptAndUpdateFile(localPath, remotePath, fileAttrs string, statusCb StatusCallback) (*Operation, error) {
 	var attrs fileref.Attributes
 	if len(fileAttrs) > 0 {
 		err := json.Unmarshal([]byte(fileAttrs), &attrs)
 		if err != nil {
-			return fmt.Errorf("failed to convert fileAttrs. %v", err)
+			return nil, fmt.Errorf("failed to convert fileAttrs. %v", err)
 		}
 	}
-	return a.sdkAllocation.EncryptAndUpdateFile(localPath, remotePath, attrs, statusCb)
+	op := a.newUploadOperation(localPath, remotePath, statusCb)
+	return op.start(func() error {
+		return a.sdkAllocation.EncryptAndUpdateFile(localPath, remotePath, attrs, a.versionedUpdate(localPath, remotePath, op))
+	})
 }
 
 // EncryptAndUpdateFileWithThumbnail - update file from local path to remote path from encrypted folder with Thumbnail
-func (a *Allocation) EncryptAndUpdateFileWithThumbnail(localPath, remotePath, fileAttrs string, thumbnailpath string, statusCb StatusCallback) error {
+func (a *Allocation) EncryptAndUpdateFileWithThumbnail(localPath, remotePath, fileAttrs string, thumbnailpath string, statusCb StatusCallback) (*Operation, error) {
 	var attrs fileref.Attributes
 	if len(fileAttrs) > 0 {
 		err := json.Unmarshal([]byte(fileAttrs), &attrs)
 		if err != nil {
-			return fmt.Errorf("failed to convert fileAttrs. %v", err)
+			return nil, fmt.Errorf("failed to convert fileAttrs. %v", err)
 		}
 	}
-	return a.sdkAllocation.EncryptAndUpdateFileWithThumbnail(localPath, remotePath, thumbnailpath, attrs, statusCb)
+	op := a.newUploadOperation(localPath, remotePath, statusCb)
+	return op.start(func() error {
+		return a.sdkAllocation.EncryptAndUpdateFileWithThumbnail(localPath, remotePath, thumbnailpath, attrs, a.versionedUpdate(localPath, remotePath, op))
+	})
 }
 
-// DeleteFile - delete file from remote path
+// DeleteFile - delete file from remote path, it's moved to trash when trash is enabled by SetTrash
 func (a *Allocation) DeleteFile(remotePath string) error {
-	return a.sdkAllocation.DeleteFile(remotePath)
+	enabled, _ := trashSettings()
+	if !enabled || isTrashPath(remotePath) {
+		return a.sdkAllocation.DeleteFile(remotePath)
+	}
+	return a.moveToTrash(remotePath)
 }
 
 // RenameObject - rename or move file
@@ -243,19 +415,37 @@ func (a *Allocation) GetAuthToken(path string, filename string, referenceType st
 	return a.sdkAllocation.GetAuthTicket(path, filename, referenceType, refereeClientID, refereeEncryptionPublicKey, expiration)
 }
 
-// DownloadFromAuthTicket - download file from Auth ticket
-func (a *Allocation) DownloadFromAuthTicket(localPath string, authTicket string, remoteLookupHash string, remoteFilename string, rxPay bool, status StatusCallback) error {
-	return a.sdkAllocation.DownloadFromAuthTicket(localPath, authTicket, remoteLookupHash, remoteFilename, rxPay, status)
+// DownloadFromAuthTicket - download file from Auth ticket. Compression records of the owner can't be read
+// with auth ticket, compressed file is downloaded as stored.
+func (a *Allocation) DownloadFromAuthTicket(localPath string, authTicket string, remoteLookupHash string, remoteFilename string, rxPay bool, status StatusCallback) (*Operation, error) {
+	op := a.newAuthTicketDownloadOperation(remoteLookupHash, remoteFilename, localPath, status)
+	return op.start(func() error {
+		return a.sdkAllocation.DownloadFromAuthTicket(localPath, authTicket, remoteLookupHash, remoteFilename, rxPay, op)
+	})
 }
 
 // DownloadFromAuthTicketByBlocks - download file from Auth ticket by blocks number
-func (a *Allocation) DownloadFromAuthTicketByBlocks(localPath string, authTicket string, startBlock, endBlock int64, numBlocks int, remoteLookupHash string, remoteFilename string, rxPay bool, status StatusCallback) error {
-	return a.sdkAllocation.DownloadFromAuthTicketByBlocks(localPath, authTicket, startBlock, endBlock, numBlocks, remoteLookupHash, remoteFilename, rxPay, status)
+func (a *Allocation) DownloadFromAuthTicketByBlocks(localPath string, authTicket string, startBlock, endBlock int64, numBlocks int, remoteLookupHash string, remoteFilename string, rxPay bool, status StatusCallback) (*Operation, error) {
+	op := a.newAuthTicketDownloadOperation(remoteLookupHash, remoteFilename, localPath, status)
+	return op.start(func() error {
+		return a.sdkAllocation.DownloadFromAuthTicketByBlocks(localPath, authTicket, startBlock, endBlock, numBlocks, remoteLookupHash, remoteFilename, rxPay, op)
+	})
 }
 
 // DownloadThumbnailFromAuthTicket - downloadThumbnail from Auth ticket
-func (a *Allocation) DownloadThumbnailFromAuthTicket(localPath string, authTicket string, remoteLookupHash string, remoteFilename string, rxPay bool, status StatusCallback) error {
-	return a.sdkAllocation.DownloadThumbnailFromAuthTicket(localPath, authTicket, remoteLookupHash, remoteFilename, rxPay, status)
+func (a *Allocation) DownloadThumbnailFromAuthTicket(localPath string, authTicket string, remoteLookupHash string, remoteFilename string, rxPay bool, status StatusCallback) (*Operation, error) {
+	op := a.newAuthTicketDownloadOperation(remoteLookupHash, remoteFilename, localPath, status)
+	return op.start(func() error {
+		return a.sdkAllocation.DownloadThumbnailFromAuthTicket(localPath, authTicket, remoteLookupHash, remoteFilename, rxPay, op)
+	})
+}
+
+// auth ticket downloads are tracked by lookup hash in sdk
+func (a *Allocation) newAuthTicketDownloadOperation(remoteLookupHash, remoteFilename, localPath string, statusCb StatusCallback) *Operation {
+	op := a.newCancellableOperation(OpTypeDownload, localPath, remoteFilename, "download:"+remoteLookupHash, func() error {
+		return a.sdkAllocation.CancelDownload(remoteLookupHash)
+	}, statusCb)
+	return op
 }
 
 // GetFileStats - get file stats from path
@@ -334,8 +524,11 @@ func (a *Allocation) CommitMetaTransaction(path, crudOperation, authTicket, look
 }
 
 // StartRepair - start repair files from path
-func (a *Allocation) StartRepair(localRootPath, pathToRepair string, statusCb StatusCallback) error {
-	return a.sdkAllocation.StartRepair(localRootPath, pathToRepair, statusCb)
+func (a *Allocation) StartRepair(localRootPath, pathToRepair string, statusCb StatusCallback) (*Operation, error) {
+	op := a.newCancellableOperation(OpTypeRepair, localRootPath, pathToRepair, "repair", a.sdkAllocation.CancelRepair, statusCb)
+	return op.start(func() error {
+		return a.sdkAllocation.StartRepair(localRootPath, pathToRepair, op)
+	})
 }
 
 // CancelRepair - cancel repair files from path
@@ -395,3 +588,12 @@ func (a *Allocation) GetMaxStorageCostWithBlobbers(size int64, blobbersJson stri
 	cost, err := a.sdkAllocation.GetMaxStorageCostFromBlobbers(size, *selBlobbers)
 	return fmt.Sprintf("%f", cost), err
 }
+
+// GetMaxStorageCostInFiat - getting back max cost for allocation in fiat currency
+func (a *Allocation) GetMaxStorageCostInFiat(size int64, currency string) (string, error) {
+	cost, err := a.sdkAllocation.GetMaxStorageCost(size)
+	if err != nil {
+		return "", err
+	}
+	return ConvertZcnTokenToFiat(cost, currency)
+}
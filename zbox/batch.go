@@ -0,0 +1,285 @@
+package zbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const defaultBatchConcurrency = 3
+
+// BatchStatusCallback - callback for batch upload and download progress
+type BatchStatusCallback interface {
+	// ItemStarted - transfer of item with index started
+	ItemStarted(index int, remotePath string, totalBytes int64)
+	// ItemProgress - transfer of item with index in progress
+	ItemProgress(index int, remotePath string, completedBytes int64)
+	// ItemCompleted - transfer of item with index completed
+	ItemCompleted(index int, remotePath string)
+	// ItemError - transfer of item with index failed
+	ItemError(index int, remotePath string, err error)
+	// Progress - aggregate progress of the whole batch, reported in order. completedBytes counts
+	// finished, failed and skipped items in full and never decreases
+	Progress(completedBytes, totalBytes int64, completedItems, totalItems int)
+	// BatchCompleted - all items are processed, report is BatchReport or DownloadReport JSON
+	BatchCompleted(report string)
+}
+
+// UploadSpec - single file to upload
+type UploadSpec struct {
+	LocalPath     string          `json:"local_path"`
+	RemotePath    string          `json:"remote_path"`
+	Attributes    json.RawMessage `json:"attributes,omitempty"`
+	Encrypt       bool            `json:"encrypt,omitempty"`
+	ThumbnailPath string          `json:"thumbnail_path,omitempty"`
+	// GenerateThumbnail - generate JPEG thumbnail of the image when thumbnail path isn't set
+	GenerateThumbnail *ThumbnailOptions `json:"generate_thumbnail,omitempty"`
+	// SkipUnchanged - skip upload when remote file has the same content hash, update it otherwise
+	SkipUnchanged bool `json:"skip_unchanged,omitempty"`
+}
+
+// BatchSpec - batch upload spec
+type BatchSpec struct {
+	Workdir     string        `json:"workdir"`
+	Concurrency int           `json:"concurrency,omitempty"`
+	Items       []*UploadSpec `json:"items"`
+}
+
+// BatchItemResult - result of single batch item
+type BatchItemResult struct {
+	Index      int    `json:"index"`
+	LocalPath  string `json:"local_path"`
+	RemotePath string `json:"remote_path"`
+	Size       int64  `json:"size"`
+	Error      string `json:"error,omitempty"`
+	// Unchanged - upload was skipped as remote file has the same content
+	Unchanged bool `json:"unchanged,omitempty"`
+}
+
+// BatchReport - final report of batch upload
+type BatchReport struct {
+	TotalBytes int64 `json:"total_bytes"`
+	// UploadedBytes - size of uploaded items
+	UploadedBytes int64 `json:"uploaded_bytes"`
+	// SkippedBytes - size of items skipped as unchanged
+	SkippedBytes int64              `json:"skipped_bytes"`
+	Succeeded    []*BatchItemResult `json:"succeeded"`
+	Failed       []*BatchItemResult `json:"failed"`
+}
+
+// batchProgress aggregates progress of batch items concurrently reported by workers
+type batchProgress struct {
+	mu             sync.Mutex
+	cb             BatchStatusCallback
+	items          []int64
+	totalBytes     int64
+	completedBytes int64
+	completedItems int
+}
+
+func newBatchProgress(cb BatchStatusCallback, items int, totalBytes int64) *batchProgress {
+	return &batchProgress{cb: cb, items: make([]int64, items), totalBytes: totalBytes}
+}
+
+// set raises completed bytes of item, progress going back on retries isn't reported
+func (p *batchProgress) set(idx int, completed int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if completed <= p.items[idx] {
+		return
+	}
+	p.completedBytes += completed - p.items[idx]
+	p.items[idx] = completed
+	p.cb.Progress(p.completedBytes, p.totalBytes, p.completedItems, len(p.items))
+}
+
+// done counts item in full whatever its result is
+func (p *batchProgress) done(idx int, size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if size > p.items[idx] {
+		p.completedBytes += size - p.items[idx]
+		p.items[idx] = size
+	}
+	p.completedItems++
+	p.cb.Progress(p.completedBytes, p.totalBytes, p.completedItems, len(p.items))
+}
+
+type uploadBatch struct {
+	a    *Allocation
+	spec *BatchSpec
+	cb   BatchStatusCallback
+
+	sizes    []int64
+	progress *batchProgress
+
+	mu     sync.Mutex
+	report *BatchReport
+}
+
+// UploadBatch - start upload of files listed in BatchSpec JSON.
+// Items are uploaded concurrently (3 by default), results are reported with cb.
+func (a *Allocation) UploadBatch(jsonSpec string, cb BatchStatusCallback) error {
+	spec := &BatchSpec{}
+	err := json.Unmarshal([]byte(jsonSpec), spec)
+	if err != nil {
+		return fmt.Errorf("invalid batch spec JSON. %v", err)
+	}
+	b, err := newUploadBatch(a, spec, cb)
+	if err != nil {
+		return err
+	}
+	go b.run()
+	return nil
+}
+
+func newUploadBatch(a *Allocation, spec *BatchSpec, cb BatchStatusCallback) (*uploadBatch, error) {
+	if len(spec.Items) == 0 {
+		return nil, fmt.Errorf("no items in batch spec")
+	}
+	if spec.Concurrency <= 0 {
+		spec.Concurrency = defaultBatchConcurrency
+	}
+	b := &uploadBatch{
+		a:      a,
+		spec:   spec,
+		cb:     cb,
+		sizes:  make([]int64, len(spec.Items)),
+		report: &BatchReport{Succeeded: []*BatchItemResult{}, Failed: []*BatchItemResult{}},
+	}
+	for i, item := range spec.Items {
+		if len(item.LocalPath) == 0 || len(item.RemotePath) == 0 {
+			return nil, fmt.Errorf("item %d: local and remote paths are required", i)
+		}
+		fi, err := os.Stat(item.LocalPath)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %v", i, err)
+		}
+		b.sizes[i] = fi.Size()
+		b.report.TotalBytes += fi.Size()
+	}
+	b.progress = newBatchProgress(cb, len(spec.Items), b.report.TotalBytes)
+	return b, nil
+}
+
+func (b *uploadBatch) run() {
+	sem := make(chan struct{}, b.spec.Concurrency)
+	wg := &sync.WaitGroup{}
+	for i := range b.spec.Items {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(idx int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			b.uploadItem(idx)
+		}(i)
+	}
+	wg.Wait()
+	retBytes, err := json.Marshal(b.report)
+	if err != nil {
+		retBytes = []byte("{}")
+	}
+	b.cb.BatchCompleted(string(retBytes))
+}
+
+func (b *uploadBatch) uploadItem(idx int) {
+	item := b.spec.Items[idx]
+	w := newStatusWaiter(nil)
+	w.onStarted = func(totalBytes int) {
+		b.cb.ItemStarted(idx, item.RemotePath, int64(totalBytes))
+	}
+	w.onProgress = func(completedBytes int) {
+		b.progress.set(idx, int64(completedBytes))
+		b.cb.ItemProgress(idx, item.RemotePath, int64(completedBytes))
+	}
+	var unchanged bool
+	w.onCompleted = func(op int) {
+		unchanged = op == OpUnchanged
+	}
+	_, err := b.a.uploadSpec(b.spec.Workdir, item, w)
+	if err == nil {
+		err = w.wait()
+	}
+
+	result := &BatchItemResult{Index: idx, LocalPath: item.LocalPath, RemotePath: item.RemotePath, Size: b.sizes[idx], Unchanged: unchanged}
+	if err != nil {
+		result.Error = err.Error()
+		b.cb.ItemError(idx, item.RemotePath, err)
+	} else {
+		b.cb.ItemCompleted(idx, item.RemotePath)
+	}
+	b.mu.Lock()
+	switch {
+	case err != nil:
+		b.report.Failed = append(b.report.Failed, result)
+	case unchanged:
+		b.report.Succeeded = append(b.report.Succeeded, result)
+		b.report.SkippedBytes += result.Size
+	default:
+		b.report.Succeeded = append(b.report.Succeeded, result)
+		b.report.UploadedBytes += result.Size
+	}
+	b.mu.Unlock()
+	b.progress.done(idx, b.sizes[idx])
+}
+
+// uploadSpec starts upload of single file with the variant matching spec flags
+func (a *Allocation) uploadSpec(workdir string, item *UploadSpec, statusCb StatusCallback) (*Operation, error) {
+	var fileAttrs string
+	if len(item.Attributes) > 0 && string(item.Attributes) != "null" {
+		fileAttrs = string(item.Attributes)
+	}
+	if item.SkipUnchanged {
+		fileMeta, unchanged, err := a.remoteUnchanged(item.LocalPath, item.RemotePath)
+		if err != nil {
+			return nil, err
+		}
+		if unchanged {
+			return a.skipUnchanged(item.LocalPath, item.RemotePath, fileMeta, statusCb), nil
+		}
+		if fileMeta != nil {
+			return a.updateSpec(item, fileAttrs, statusCb)
+		}
+	}
+	if item.GenerateThumbnail != nil && len(item.ThumbnailPath) == 0 {
+		options, _ := json.Marshal(item.GenerateThumbnail)
+		if item.Encrypt {
+			return a.EncryptAndUploadFileWithGeneratedThumbnail(item.LocalPath, item.RemotePath, fileAttrs, string(options), statusCb)
+		}
+		return a.UploadFileWithGeneratedThumbnail(item.LocalPath, item.RemotePath, fileAttrs, string(options), statusCb)
+	}
+	switch {
+	case item.Encrypt && len(item.ThumbnailPath) > 0:
+		return a.EncryptAndUploadFileWithThumbnail(item.LocalPath, item.RemotePath, fileAttrs, item.ThumbnailPath, statusCb)
+	case item.Encrypt:
+		return a.EncryptAndUploadFile(item.LocalPath, item.RemotePath, fileAttrs, statusCb)
+	case len(item.ThumbnailPath) > 0:
+		return a.UploadFileWithThumbnail(item.LocalPath, item.RemotePath, fileAttrs, item.ThumbnailPath, statusCb)
+	default:
+		return a.UploadFile(workdir, item.LocalPath, item.RemotePath, fileAttrs, statusCb)
+	}
+}
+
+// updateSpec updates existing remote file with the variant matching spec flags
+func (a *Allocation) updateSpec(item *UploadSpec, fileAttrs string, statusCb StatusCallback) (*Operation, error) {
+	if item.GenerateThumbnail != nil && len(item.ThumbnailPath) == 0 {
+		options, _ := json.Marshal(item.GenerateThumbnail)
+		if item.Encrypt {
+			return a.EncryptAndUpdateFileWithGeneratedThumbnail(item.LocalPath, item.RemotePath, fileAttrs, string(options), statusCb)
+		}
+		return a.UpdateFileWithGeneratedThumbnail(item.LocalPath, item.RemotePath, fileAttrs, string(options), statusCb)
+	}
+	switch {
+	case item.Encrypt && len(item.ThumbnailPath) > 0:
+		return a.EncryptAndUpdateFileWithThumbnail(item.LocalPath, item.RemotePath, fileAttrs, item.ThumbnailPath, statusCb)
+	case item.Encrypt:
+		return a.EncryptAndUpdateFile(item.LocalPath, item.RemotePath, fileAttrs, statusCb)
+	case len(item.ThumbnailPath) > 0:
+		return a.UpdateFileWithThumbnail(item.LocalPath, item.RemotePath, fileAttrs, item.ThumbnailPath, statusCb)
+	default:
+		return a.UpdateFile(item.LocalPath, item.RemotePath, fileAttrs, statusCb)
+	}
+}
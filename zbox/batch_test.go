@@ -0,0 +1,61 @@
+package zbox
+
+import (
+	"sync"
+	"testing"
+)
+
+// testBatchCallback records aggregate progress reports
+type testBatchCallback struct {
+	completed []int64
+	items     []int
+}
+
+func (cb *testBatchCallback) ItemStarted(index int, remotePath string, totalBytes int64)      {}
+func (cb *testBatchCallback) ItemProgress(index int, remotePath string, completedBytes int64) {}
+func (cb *testBatchCallback) ItemCompleted(index int, remotePath string)                      {}
+func (cb *testBatchCallback) ItemError(index int, remotePath string, err error)               {}
+func (cb *testBatchCallback) BatchCompleted(report string)                                    {}
+
+func (cb *testBatchCallback) Progress(completedBytes, totalBytes int64, completedItems, totalItems int) {
+	cb.completed = append(cb.completed, completedBytes)
+	cb.items = append(cb.items, completedItems)
+}
+
+func TestBatchProgressIsMonotonic(t *testing.T) {
+	cb := &testBatchCallback{}
+	p := newBatchProgress(cb, 4, 4000)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			for n := int64(0); n <= 1000; n += 10 {
+				p.set(idx, n)
+				// retried chunk reports smaller progress
+				p.set(idx, n/2)
+			}
+			p.done(idx, 1000)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 1; i < len(cb.completed); i++ {
+		if cb.completed[i] < cb.completed[i-1] || cb.items[i] < cb.items[i-1] {
+			t.Fatalf("progress went back from %d to %d", cb.completed[i-1], cb.completed[i])
+		}
+	}
+	if last := len(cb.completed) - 1; cb.completed[last] != 4000 || cb.items[last] != 4 {
+		t.Fatalf("expected complete batch, got %d bytes of %d items", cb.completed[last], cb.items[last])
+	}
+
+	// failed item is counted in full
+	cb = &testBatchCallback{}
+	p = newBatchProgress(cb, 2, 200)
+	p.set(0, 30)
+	p.done(0, 100)
+	p.done(1, 100)
+	if cb.completed[2] != 200 {
+		t.Fatalf("expected all bytes processed, got %v", cb.completed)
+	}
+}
@@ -0,0 +1,659 @@
+package zbox
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/client"
+	l "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zcncore"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	// ZCNSC smart contract address on 0chain
+	zcnscAddress = "6dba10422e368813802877a85039d3985d96760ed844092319743fb3a712d0"
+
+	bridgeTransfersFile = "bridge_transfers.json"
+
+	// zcn value has 10 decimals
+	zcnDecimals = 10
+)
+
+// Bridge transfer directions
+const (
+	BridgeZcnToWzcn = "zcn_to_wzcn"
+	BridgeWzcnToZcn = "wzcn_to_zcn"
+)
+
+// Bridge transfer statuses
+const (
+	BridgeStatusBurning           = "burning"
+	BridgeStatusBurned            = "burned"
+	BridgeStatusCollectingTickets = "collecting_tickets"
+	BridgeStatusMinting           = "minting"
+	BridgeStatusCompleted         = "completed"
+	BridgeStatusFailed            = "failed"
+)
+
+const bridgeABI = `[
+	{"type":"function","name":"mint","stateMutability":"nonpayable","inputs":[
+		{"name":"to","type":"address"},{"name":"amount","type":"uint256"},
+		{"name":"txid","type":"bytes"},{"name":"nonce","type":"uint256"},
+		{"name":"signatures","type":"bytes[]"}],"outputs":[]},
+	{"type":"function","name":"burn","stateMutability":"nonpayable","inputs":[
+		{"name":"amount","type":"uint256"},{"name":"clientId","type":"bytes"}],"outputs":[]}
+]`
+
+const erc20ABI = `[
+	{"type":"function","name":"approve","stateMutability":"nonpayable","inputs":[
+		{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}],
+		"outputs":[{"name":"","type":"bool"}]}
+]`
+
+// BridgeConfig - ZCN <-> WZCN bridge config
+type BridgeConfig struct {
+	EthNodeURL         string   `json:"eth_node_url"`
+	EthChainID         int64    `json:"eth_chain_id,omitempty"`
+	BridgeAddress      string   `json:"bridge_address"`
+	WzcnAddress        string   `json:"wzcn_address"`
+	WzcnDecimals       int      `json:"wzcn_decimals,omitempty"`
+	Authorizers        []string `json:"authorizers"`
+	ConsensusThreshold float64  `json:"consensus_threshold,omitempty"`
+	GasLimit           uint64   `json:"gas_limit,omitempty"`
+	WorkDir            string   `json:"work_dir"`
+}
+
+// BridgeCallback - callback for bridge transfers
+type BridgeCallback interface {
+	OnStatus(transferID string, status string, info string)
+	OnError(transferID string, err error)
+}
+
+// BridgeTransfer - state of single bridge transfer
+type BridgeTransfer struct {
+	ID         string            `json:"id"`
+	Direction  string            `json:"direction"`
+	Amount     int64             `json:"amount"`
+	From       string            `json:"from"`
+	To         string            `json:"to"`
+	Status     string            `json:"status"`
+	BurnHash   string            `json:"burn_hash,omitempty"`
+	MintHash   string            `json:"mint_hash,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	CreatedAt  int64             `json:"created_at"`
+	UpdatedAt  int64             `json:"updated_at"`
+	Nonce      int64             `json:"nonce,omitempty"`
+	FeeValue   int64             `json:"fee,omitempty"`
+	Signatures []bridgeSignature `json:"signatures,omitempty"`
+	// Txs - transactions sent by transfer steps (approve, burn, mint)
+	Txs map[string]*bridgeTx `json:"txs,omitempty"`
+}
+
+// bridgeTx - transaction of a transfer step. It's saved before the transaction is sent,
+// so a resumed transfer waits for it instead of sending it again.
+type bridgeTx struct {
+	Hash  string `json:"hash,omitempty"`
+	Nonce uint64 `json:"nonce,omitempty"`
+	// Raw - signed eth transaction, sent again on resume while it's not mined
+	Raw string `json:"raw,omitempty"`
+}
+
+type bridgeSignature struct {
+	AuthorizerID string `json:"authorizer_id"`
+	Signature    string `json:"signature"`
+}
+
+// ticket returned by authorizers for both burn directions
+type bridgeBurnTicket struct {
+	EthereumAddress   string          `json:"ethereum_address,omitempty"`
+	EthereumTxHash    string          `json:"ethereum_tx_hash,omitempty"`
+	TxnID             string          `json:"txn_id,omitempty"`
+	ReceivingClientID string          `json:"receiving_client_id,omitempty"`
+	Amount            int64           `json:"amount"`
+	Nonce             int64           `json:"nonce"`
+	Signature         bridgeSignature `json:"signature"`
+}
+
+type zcnMintPayload struct {
+	EthereumTxnID     string            `json:"ethereum_txn_id"`
+	Amount            int64             `json:"amount"`
+	Nonce             int64             `json:"nonce"`
+	Signatures        []bridgeSignature `json:"signatures"`
+	ReceivingClientID string            `json:"receiving_client_id"`
+}
+
+type zcnBurnPayload struct {
+	EthereumAddress string `json:"ethereum_address"`
+}
+
+// bridgeEthBackend is satisfied by ethclient.Client and by simulated backends
+type bridgeEthBackend interface {
+	bind.ContractBackend
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// dialBridgeEth can be replaced to run the bridge against a local JSON-RPC stand-in
+var dialBridgeEth = func(rawurl string) (bridgeEthBackend, error) {
+	return ethclient.Dial(rawurl)
+}
+
+type bridge struct {
+	mu sync.Mutex
+	// saveMu - orders snapshots written by save, taken before mu
+	saveMu    sync.Mutex
+	cfg       *BridgeConfig
+	eth       bridgeEthBackend
+	chainID   *big.Int
+	bridgeABI abi.ABI
+	erc20ABI  abi.ABI
+	transfers map[string]*BridgeTransfer
+	// running - IDs of transfers being processed
+	running map[string]bool
+}
+
+// InitBridge - init ZCN <-> WZCN bridge from config and load pending transfers
+func (s *StorageSDK) InitBridge(configJson string) error {
+	cfg := &BridgeConfig{}
+	err := json.Unmarshal([]byte(configJson), cfg)
+	if err != nil {
+		return fmt.Errorf("invalid bridge config JSON. %v", err)
+	}
+	if len(cfg.BridgeAddress) == 0 || len(cfg.WzcnAddress) == 0 {
+		return fmt.Errorf("bridge and wzcn contract addresses are required")
+	}
+	if len(cfg.Authorizers) == 0 {
+		return fmt.Errorf("no bridge authorizers in config")
+	}
+	if cfg.WzcnDecimals == 0 {
+		cfg.WzcnDecimals = zcnDecimals
+	}
+	if cfg.ConsensusThreshold <= 0 || cfg.ConsensusThreshold > 1 {
+		cfg.ConsensusThreshold = 0.7
+	}
+	if cfg.GasLimit == 0 {
+		cfg.GasLimit = 300000
+	}
+	if len(cfg.EthNodeURL) == 0 {
+		cfg.EthNodeURL = s.chainconfig.EthNode
+	}
+	eth, err := dialBridgeEth(cfg.EthNodeURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to eth node. %v", err)
+	}
+	b := &bridge{cfg: cfg, eth: eth, transfers: make(map[string]*BridgeTransfer), running: make(map[string]bool)}
+	if b.bridgeABI, err = abi.JSON(strings.NewReader(bridgeABI)); err != nil {
+		return err
+	}
+	if b.erc20ABI, err = abi.JSON(strings.NewReader(erc20ABI)); err != nil {
+		return err
+	}
+	if cfg.EthChainID > 0 {
+		b.chainID = big.NewInt(cfg.EthChainID)
+	} else if c, ok := eth.(interface {
+		ChainID(ctx context.Context) (*big.Int, error)
+	}); ok {
+		if b.chainID, err = c.ChainID(context.Background()); err != nil {
+			return fmt.Errorf("failed to get eth chain id. %v", err)
+		}
+	} else {
+		return fmt.Errorf("eth_chain_id is required for this eth backend")
+	}
+	if err = b.load(); err != nil {
+		return err
+	}
+	s.bridge = b
+	return nil
+}
+
+// BurnZcnForWzcn - burn ZCN tokens on 0chain and mint the same amount of WZCN to ethAddress.
+// ethPrivateKey is used to send the mint transaction on Ethereum. Returns transfer ID.
+func (s *StorageSDK) BurnZcnForWzcn(tokens, fee float64, ethAddress, ethPrivateKey string, cb BridgeCallback) (string, error) {
+	if s.bridge == nil {
+		return "", fmt.Errorf("bridge is not initialized")
+	}
+	if !common.IsHexAddress(ethAddress) {
+		return "", fmt.Errorf("invalid eth address %s", ethAddress)
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(ethPrivateKey, "0x"))
+	if err != nil {
+		return "", fmt.Errorf("invalid eth private key. %v", err)
+	}
+	t := s.bridge.newTransfer(BridgeZcnToWzcn, zcncore.ConvertToValue(tokens), client.GetClientID(), ethAddress)
+	t.FeeValue = zcncore.ConvertToValue(fee)
+	go s.bridge.run(t, key, cb)
+	return t.ID, nil
+}
+
+// BurnWzcnForZcn - burn WZCN tokens on Ethereum and mint the same amount of ZCN to current client.
+// Returns transfer ID.
+func (s *StorageSDK) BurnWzcnForZcn(tokens, fee float64, ethPrivateKey string, cb BridgeCallback) (string, error) {
+	if s.bridge == nil {
+		return "", fmt.Errorf("bridge is not initialized")
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(ethPrivateKey, "0x"))
+	if err != nil {
+		return "", fmt.Errorf("invalid eth private key. %v", err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	t := s.bridge.newTransfer(BridgeWzcnToZcn, zcncore.ConvertToValue(tokens), from, client.GetClientID())
+	t.FeeValue = zcncore.ConvertToValue(fee)
+	go s.bridge.run(t, key, cb)
+	return t.ID, nil
+}
+
+// GetBridgeTransfers - get list of tracked bridge transfers
+func (s *StorageSDK) GetBridgeTransfers() (string, error) {
+	if s.bridge == nil {
+		return "", fmt.Errorf("bridge is not initialized")
+	}
+	s.bridge.mu.Lock()
+	result := make([]*BridgeTransfer, 0, len(s.bridge.transfers))
+	for _, t := range s.bridge.transfers {
+		result = append(result, t)
+	}
+	retBytes, err := json.Marshal(result)
+	s.bridge.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	return string(retBytes), nil
+}
+
+// ResumeBridgeTransfers - continue pending bridge transfers from their last finished step.
+// Transfers already running are skipped. Transactions sent before the app stopped are awaited,
+// never sent again; a 0chain transaction interrupted before miners returned its hash fails the transfer.
+func (s *StorageSDK) ResumeBridgeTransfers(ethPrivateKey string, cb BridgeCallback) error {
+	if s.bridge == nil {
+		return fmt.Errorf("bridge is not initialized")
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(ethPrivateKey, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid eth private key. %v", err)
+	}
+	s.bridge.mu.Lock()
+	pending := make([]*BridgeTransfer, 0)
+	for _, t := range s.bridge.transfers {
+		if t.Status != BridgeStatusCompleted && t.Status != BridgeStatusFailed {
+			pending = append(pending, t)
+		}
+	}
+	s.bridge.mu.Unlock()
+	for _, t := range pending {
+		go s.bridge.run(t, key, cb)
+	}
+	return nil
+}
+
+func (b *bridge) newTransfer(direction string, amount int64, from, to string) *BridgeTransfer {
+	now := time.Now().Unix()
+	t := &BridgeTransfer{
+		ID:        strconv.FormatInt(time.Now().UnixNano(), 36),
+		Direction: direction,
+		Amount:    amount,
+		From:      from,
+		To:        to,
+		Status:    BridgeStatusBurning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	b.mu.Lock()
+	b.transfers[t.ID] = t
+	b.mu.Unlock()
+	b.save()
+	return t
+}
+
+// acquire marks transfer as running, returns false when it's already running
+func (b *bridge) acquire(id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.running[id] {
+		return false
+	}
+	b.running[id] = true
+	return true
+}
+
+func (b *bridge) release(id string) {
+	b.mu.Lock()
+	delete(b.running, id)
+	b.mu.Unlock()
+}
+
+func (b *bridge) status(t *BridgeTransfer) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return t.Status
+}
+
+func (b *bridge) sentTx(t *BridgeTransfer, step string) *bridgeTx {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return t.Txs[step]
+}
+
+func (b *bridge) setTx(t *BridgeTransfer, step string, tx *bridgeTx) {
+	b.mu.Lock()
+	if t.Txs == nil {
+		t.Txs = make(map[string]*bridgeTx)
+	}
+	t.Txs[step] = tx
+	b.mu.Unlock()
+	b.save()
+}
+
+func (b *bridge) setStatus(t *BridgeTransfer, status string, cb BridgeCallback, info string) {
+	b.mu.Lock()
+	t.Status = status
+	t.UpdatedAt = time.Now().Unix()
+	b.mu.Unlock()
+	b.save()
+	if cb != nil {
+		cb.OnStatus(t.ID, status, info)
+	}
+}
+
+func (b *bridge) fail(t *BridgeTransfer, cb BridgeCallback, err error) {
+	l.Logger.Error("bridge transfer ", t.ID, " failed: ", err)
+	b.mu.Lock()
+	t.Error = err.Error()
+	b.mu.Unlock()
+	b.setStatus(t, BridgeStatusFailed, cb, err.Error())
+	if cb != nil {
+		cb.OnError(t.ID, err)
+	}
+}
+
+func (b *bridge) run(t *BridgeTransfer, key *ecdsa.PrivateKey, cb BridgeCallback) {
+	if !b.acquire(t.ID) {
+		return
+	}
+	defer b.release(t.ID)
+	var hash string
+	var err error
+	if b.status(t) == BridgeStatusBurning {
+		if t.Direction == BridgeZcnToWzcn {
+			hash, err = b.burnZcn(t)
+		} else {
+			hash, err = b.burnWzcn(t, key)
+		}
+		if err != nil {
+			b.fail(t, cb, fmt.Errorf("burn failed. %v", err))
+			return
+		}
+		b.mu.Lock()
+		t.BurnHash = hash
+		b.mu.Unlock()
+		b.setStatus(t, BridgeStatusBurned, cb, hash)
+	}
+	if status := b.status(t); status == BridgeStatusBurned || status == BridgeStatusCollectingTickets {
+		b.setStatus(t, BridgeStatusCollectingTickets, cb, "")
+		if err = b.collectTickets(t); err != nil {
+			b.fail(t, cb, err)
+			return
+		}
+		b.setStatus(t, BridgeStatusMinting, cb, "")
+	}
+	if b.status(t) == BridgeStatusMinting {
+		if t.Direction == BridgeZcnToWzcn {
+			hash, err = b.mintWzcn(t, key)
+		} else {
+			hash, err = b.mintZcn(t)
+		}
+		if err != nil {
+			b.fail(t, cb, fmt.Errorf("mint failed. %v", err))
+			return
+		}
+		b.mu.Lock()
+		t.MintHash = hash
+		b.mu.Unlock()
+		b.setStatus(t, BridgeStatusCompleted, cb, hash)
+	}
+}
+
+func (b *bridge) burnZcn(t *BridgeTransfer) (string, error) {
+	return b.zcnTransact(t, "burn", &zcnBurnPayload{EthereumAddress: t.To}, t.Amount)
+}
+
+func (b *bridge) mintZcn(t *BridgeTransfer) (string, error) {
+	payload := &zcnMintPayload{
+		EthereumTxnID:     t.BurnHash,
+		Amount:            t.Amount,
+		Nonce:             t.Nonce,
+		Signatures:        t.Signatures,
+		ReceivingClientID: t.To,
+	}
+	return b.zcnTransact(t, "mint", payload, 0)
+}
+
+// zcnTransact submits ZCNSC transaction of step once and waits until it's confirmed.
+// Resumed step only verifies the saved transaction.
+func (b *bridge) zcnTransact(t *BridgeTransfer, method string, input interface{}, value int64) (string, error) {
+	sent := b.sentTx(t, method)
+	if sent == nil {
+		// mark step as submitted, the hash is known only after miners accepted the transaction
+		b.setTx(t, method, &bridgeTx{})
+		hash, err := submitSmartContract(zcnscAddress, method, input, value, t.FeeValue)
+		if err != nil {
+			return "", err
+		}
+		sent = &bridgeTx{Hash: hash}
+		b.setTx(t, method, sent)
+	} else if len(sent.Hash) == 0 {
+		return "", fmt.Errorf("%s transaction was interrupted before it was accepted, check the balance before retrying", method)
+	}
+	if err := verifyTransaction(sent.Hash); err != nil {
+		return "", err
+	}
+	return sent.Hash, nil
+}
+
+func (b *bridge) burnWzcn(t *BridgeTransfer, key *ecdsa.PrivateKey) (string, error) {
+	amount := b.toWzcnAmount(t.Amount)
+	_, err := b.transact(t, "approve", key, b.cfg.WzcnAddress, b.erc20ABI, common.HexToAddress(b.cfg.BridgeAddress), amount)
+	if err != nil {
+		return "", fmt.Errorf("approve failed. %v", err)
+	}
+	return b.transact(t, "burn", key, b.cfg.BridgeAddress, b.bridgeABI, amount, []byte(t.To))
+}
+
+func (b *bridge) mintWzcn(t *BridgeTransfer, key *ecdsa.PrivateKey) (string, error) {
+	signatures := make([][]byte, 0, len(t.Signatures))
+	for _, s := range t.Signatures {
+		sig, err := hexutil.Decode(s.Signature)
+		if err != nil {
+			return "", fmt.Errorf("invalid authorizer signature. %v", err)
+		}
+		signatures = append(signatures, sig)
+	}
+	return b.transact(t, "mint", key, b.cfg.BridgeAddress, b.bridgeABI,
+		common.HexToAddress(t.To), b.toWzcnAmount(t.Amount), []byte(t.BurnHash), big.NewInt(t.Nonce), signatures)
+}
+
+func (b *bridge) toWzcnAmount(value int64) *big.Int {
+	amount := big.NewInt(value)
+	diff := b.cfg.WzcnDecimals - zcnDecimals
+	if diff > 0 {
+		amount.Mul(amount, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(diff)), nil))
+	} else if diff < 0 {
+		amount.Div(amount, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-diff)), nil))
+	}
+	return amount
+}
+
+// transact calls contract method of transfer step and waits until the transaction is mined.
+// Signed transaction is saved before it's sent, resumed step waits for the saved transaction
+// and sends it again when the node lost it. Same nonce keeps it from being executed twice.
+func (b *bridge) transact(t *BridgeTransfer, method string, key *ecdsa.PrivateKey, address string, contractABI abi.ABI, params ...interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	var tx *types.Transaction
+	if sent := b.sentTx(t, method); sent != nil {
+		raw, err := hexutil.Decode(sent.Raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid saved %s transaction. %v", method, err)
+		}
+		tx = new(types.Transaction)
+		if err = tx.UnmarshalBinary(raw); err != nil {
+			return "", fmt.Errorf("invalid saved %s transaction. %v", method, err)
+		}
+		if !b.mined(ctx, tx) {
+			if err = b.eth.SendTransaction(ctx, tx); err != nil {
+				l.Logger.Info("resend of ", tx.Hash().Hex(), ": ", err)
+				if strings.Contains(err.Error(), "nonce too low") && !b.mined(ctx, tx) {
+					return "", fmt.Errorf("eth transaction %s was replaced. %v", tx.Hash().Hex(), err)
+				}
+			}
+		}
+	} else {
+		opts, err := bind.NewKeyedTransactorWithChainID(key, b.chainID)
+		if err != nil {
+			return "", err
+		}
+		opts.GasLimit = b.cfg.GasLimit
+		opts.Context = ctx
+		opts.NoSend = true
+		contract := bind.NewBoundContract(common.HexToAddress(address), contractABI, b.eth, b.eth, b.eth)
+		if tx, err = contract.Transact(opts, method, params...); err != nil {
+			return "", err
+		}
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		b.setTx(t, method, &bridgeTx{Hash: tx.Hash().Hex(), Nonce: tx.Nonce(), Raw: hexutil.Encode(raw)})
+		if err = b.eth.SendTransaction(ctx, tx); err != nil {
+			return "", err
+		}
+	}
+	receipt, err := bind.WaitMined(ctx, b.eth, tx)
+	if err != nil {
+		return "", err
+	}
+	if receipt.Status != 1 {
+		return "", fmt.Errorf("eth transaction %s reverted", tx.Hash().Hex())
+	}
+	return tx.Hash().Hex(), nil
+}
+
+func (b *bridge) mined(ctx context.Context, tx *types.Transaction) bool {
+	receipt, err := b.eth.TransactionReceipt(ctx, tx.Hash())
+	return err == nil && receipt != nil
+}
+
+// collectTickets requests burn tickets from authorizers until consensus is reached
+func (b *bridge) collectTickets(t *BridgeTransfer) error {
+	path := "/v1/0chain/burnticket/get"
+	if t.Direction == BridgeWzcnToZcn {
+		path = "/v1/ether/burnticket/get"
+	}
+	required := int(float64(len(b.cfg.Authorizers))*b.cfg.ConsensusThreshold + 0.999)
+	for attempt := 0; attempt < 30; attempt++ {
+		signatures := make([]bridgeSignature, 0, len(b.cfg.Authorizers))
+		var nonce int64
+		for _, authorizer := range b.cfg.Authorizers {
+			ticket, err := getBurnTicket(authorizer+path, t.BurnHash)
+			if err != nil {
+				l.Logger.Info("burn ticket from ", authorizer, " not ready: ", err)
+				continue
+			}
+			if ticket.Amount != t.Amount {
+				l.Logger.Error("burn ticket amount mismatch from ", authorizer)
+				continue
+			}
+			nonce = ticket.Nonce
+			signatures = append(signatures, ticket.Signature)
+		}
+		if len(signatures) >= required {
+			b.mu.Lock()
+			t.Nonce = nonce
+			t.Signatures = signatures
+			b.mu.Unlock()
+			return nil
+		}
+		time.Sleep(10 * time.Second)
+	}
+	return fmt.Errorf("not enough authorizer signatures for %s", t.BurnHash)
+}
+
+func getBurnTicket(endpoint, hash string) (*bridgeBurnTicket, error) {
+	resp, err := http.Get(endpoint + "?hash=" + url.QueryEscape(hash))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	ticket := &bridgeBurnTicket{}
+	if err = json.Unmarshal(body, ticket); err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+func (b *bridge) load() error {
+	if len(b.cfg.WorkDir) == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(b.cfg.WorkDir, bridgeTransfersFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var transfers []*BridgeTransfer
+	if err = json.Unmarshal(data, &transfers); err != nil {
+		return fmt.Errorf("failed to load bridge transfers. %v", err)
+	}
+	for _, t := range transfers {
+		b.transfers[t.ID] = t
+	}
+	return nil
+}
+
+func (b *bridge) save() {
+	if len(b.cfg.WorkDir) == 0 {
+		return
+	}
+	// later snapshot is always written after earlier one
+	b.saveMu.Lock()
+	defer b.saveMu.Unlock()
+	b.mu.Lock()
+	transfers := make([]*BridgeTransfer, 0, len(b.transfers))
+	for _, t := range b.transfers {
+		transfers = append(transfers, t)
+	}
+	data, err := json.Marshal(transfers)
+	b.mu.Unlock()
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(b.cfg.WorkDir, bridgeTransfersFile), data)
+	}
+	if err != nil {
+		l.Logger.Error("failed to save bridge transfers: ", err)
+	}
+}
@@ -0,0 +1,187 @@
+package zbox
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// testEthBackend mines every sent transaction, checks it was saved before sending
+// and can drop sends to simulate lost connection
+type testEthBackend struct {
+	*backends.SimulatedBackend
+	mu        sync.Mutex
+	workDir   string
+	failSends int
+	sent      []string
+}
+
+func (b *testEthBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, err := ioutil.ReadFile(filepath.Join(b.workDir, bridgeTransfersFile))
+	if err != nil || !strings.Contains(string(data), tx.Hash().Hex()) {
+		return fmt.Errorf("transaction %s was not saved before sending", tx.Hash().Hex())
+	}
+	if b.failSends > 0 {
+		b.failSends--
+		return fmt.Errorf("connection lost")
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+	nonce, err := b.PendingNonceAt(ctx, from)
+	if err != nil {
+		return err
+	}
+	if tx.Nonce() < nonce {
+		return fmt.Errorf("nonce too low")
+	}
+	if err = b.SimulatedBackend.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	b.Commit()
+	b.sent = append(b.sent, tx.Hash().Hex())
+	return nil
+}
+
+func newTestBridge(t *testing.T) (*bridge, *testEthBackend, *ecdsa.PrivateKey, func()) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	workDir, err := ioutil.TempDir("", "bridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alloc := core.GenesisAlloc{crypto.PubkeyToAddress(key.PublicKey): {Balance: big.NewInt(1e18)}}
+	backend := &testEthBackend{SimulatedBackend: backends.NewSimulatedBackend(alloc, 8000000), workDir: workDir}
+	dial := dialBridgeEth
+	dialBridgeEth = func(rawurl string) (bridgeEthBackend, error) {
+		return backend, nil
+	}
+	b := initTestBridge(t, workDir)
+	return b, backend, key, func() {
+		dialBridgeEth = dial
+		backend.Close()
+		os.RemoveAll(workDir)
+	}
+}
+
+func initTestBridge(t *testing.T, workDir string) *bridge {
+	s := &StorageSDK{chainconfig: &ChainConfig{}}
+	err := s.InitBridge(`{"eth_node_url":"simulated","eth_chain_id":1337,` +
+		`"bridge_address":"0x00000000000000000000000000000000000000b1",` +
+		`"wzcn_address":"0x00000000000000000000000000000000000000b2",` +
+		`"authorizers":["http://127.0.0.1:1"],"work_dir":"` + workDir + `"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.bridge
+}
+
+func newTestMintTransfer(b *bridge) *BridgeTransfer {
+	t := b.newTransfer(BridgeZcnToWzcn, 1e10, "client", "0x00000000000000000000000000000000000000c1")
+	t.BurnHash = "burnhash"
+	b.setStatus(t, BridgeStatusMinting, nil, "")
+	return t
+}
+
+func TestBridgeMintIsNotSentAgainOnResume(t *testing.T) {
+	b, backend, key, cleanup := newTestBridge(t)
+	defer cleanup()
+
+	transfer := newTestMintTransfer(b)
+	b.run(transfer, key, nil)
+	if transfer.Status != BridgeStatusCompleted {
+		t.Fatalf("expected completed transfer, got %s %s", transfer.Status, transfer.Error)
+	}
+	if len(backend.sent) != 1 || transfer.MintHash != backend.sent[0] {
+		t.Fatalf("expected single mint transaction, got %v", backend.sent)
+	}
+
+	// app was killed after the mint was mined but before the status was saved
+	b.setStatus(transfer, BridgeStatusMinting, nil, "")
+	resumed := initTestBridge(t, backend.workDir)
+	rt := resumed.transfers[transfer.ID]
+	resumed.run(rt, key, nil)
+	if rt.Status != BridgeStatusCompleted {
+		t.Fatalf("expected completed transfer, got %s %s", rt.Status, rt.Error)
+	}
+	if len(backend.sent) != 1 || rt.MintHash != transfer.MintHash {
+		t.Fatalf("mint was sent again: %v", backend.sent)
+	}
+}
+
+func TestBridgeLostMintIsResent(t *testing.T) {
+	b, backend, key, cleanup := newTestBridge(t)
+	defer cleanup()
+
+	backend.failSends = 1
+	transfer := newTestMintTransfer(b)
+	b.run(transfer, key, nil)
+	if transfer.Status != BridgeStatusFailed {
+		t.Fatalf("expected failed transfer, got %s", transfer.Status)
+	}
+	saved := transfer.Txs["mint"]
+	if saved == nil || len(saved.Raw) == 0 {
+		t.Fatal("mint transaction was not saved")
+	}
+
+	// app was killed after the mint was saved but before it reached the node
+	b.setStatus(transfer, BridgeStatusMinting, nil, "")
+	resumed := initTestBridge(t, backend.workDir)
+	rt := resumed.transfers[transfer.ID]
+	resumed.run(rt, key, nil)
+	if rt.Status != BridgeStatusCompleted {
+		t.Fatalf("expected completed transfer, got %s %s", rt.Status, rt.Error)
+	}
+	if len(backend.sent) != 1 || backend.sent[0] != saved.Hash || rt.MintHash != saved.Hash {
+		t.Fatalf("expected saved mint %s to be sent, got %v", saved.Hash, backend.sent)
+	}
+}
+
+func TestBridgeInterruptedZcnBurnIsNotRepeated(t *testing.T) {
+	b, _, key, cleanup := newTestBridge(t)
+	defer cleanup()
+
+	transfer := b.newTransfer(BridgeZcnToWzcn, 1e10, "client", "0x00000000000000000000000000000000000000c1")
+	// burn was submitted but the app was killed before miners returned its hash
+	b.setTx(transfer, "burn", &bridgeTx{})
+	b.run(transfer, key, nil)
+	if transfer.Status != BridgeStatusFailed {
+		t.Fatalf("expected failed transfer, got %s", transfer.Status)
+	}
+	if len(transfer.Txs["burn"].Hash) != 0 {
+		t.Fatal("burn was submitted again")
+	}
+}
+
+func TestBridgeTransferRunsOnce(t *testing.T) {
+	b, _, _, cleanup := newTestBridge(t)
+	defer cleanup()
+
+	if !b.acquire("id") {
+		t.Fatal("expected transfer to start")
+	}
+	if b.acquire("id") {
+		t.Fatal("transfer started twice")
+	}
+	b.release("id")
+	if !b.acquire("id") {
+		t.Fatal("expected finished transfer to start again")
+	}
+}
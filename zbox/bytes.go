@@ -0,0 +1,119 @@
+package zbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// maxBytesFileSize - size limit of files written and read in memory
+const maxBytesFileSize = 16 * 1024 * 1024
+
+func parseFileAttrs(fileAttrs string) (fileref.Attributes, error) {
+	var attrs fileref.Attributes
+	if len(fileAttrs) > 0 {
+		if err := json.Unmarshal([]byte(fileAttrs), &attrs); err != nil {
+			return attrs, fmt.Errorf("failed to convert fileAttrs. %v", err)
+		}
+	}
+	return attrs, nil
+}
+
+// WriteBytes - write data to remote file and wait for commit, existing file is updated.
+// Sdk uploads from a path, data is staged in private file of SDK work dir until upload starts.
+func (a *Allocation) WriteBytes(remotePath string, data []byte, fileAttrs string) error {
+	return a.writeBytes(remotePath, data, fileAttrs, false)
+}
+
+// EncryptAndWriteBytes - write data to encrypted remote file and wait for commit, existing file is updated.
+// Sdk uploads from a path, plain data is staged in private file of SDK work dir until upload starts.
+func (a *Allocation) EncryptAndWriteBytes(remotePath string, data []byte, fileAttrs string) error {
+	return a.writeBytes(remotePath, data, fileAttrs, true)
+}
+
+func (a *Allocation) writeBytes(remotePath string, data []byte, fileAttrs string, encrypt bool) error {
+	if len(data) > maxBytesFileSize {
+		return fmt.Errorf("data size %d exceeds limit %d", len(data), maxBytesFileSize)
+	}
+	attrs, err := parseFileAttrs(fileAttrs)
+	if err != nil {
+		return err
+	}
+	fileMeta, err := a.remoteFileMeta(remotePath)
+	if err != nil {
+		return err
+	}
+	update := fileMeta != nil
+
+	dir, err := newSpoolDir("bytes")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	localPath := filepath.Join(dir, path.Base(remotePath))
+	if err = ioutil.WriteFile(localPath, data, 0600); err != nil {
+		return err
+	}
+	w := newStatusWaiter(nil)
+	// sdk keeps the file opened till the end of upload
+	w.onStarted = func(totalBytes int) {
+		if err := os.Remove(localPath); err != nil {
+			l.Logger.Error("failed to remove staged data: ", err)
+		}
+	}
+	switch {
+	case update && encrypt:
+		err = a.sdkAllocation.EncryptAndUpdateFile(localPath, remotePath, attrs, a.versionedUpdate(localPath, remotePath, w))
+	case update:
+		err = a.sdkAllocation.UpdateFile(localPath, remotePath, attrs, a.versionedUpdate(localPath, remotePath, w))
+	case encrypt:
+		err = a.sdkAllocation.EncryptAndUploadFile(localPath, remotePath, attrs, w)
+	default:
+		err = a.sdkAllocation.UploadFile(localPath, remotePath, attrs, w)
+	}
+	if err == nil {
+		err = w.wait()
+	}
+	return err
+}
+
+// bytesWriter collects downloaded content in memory
+type bytesWriter struct {
+	data []byte
+}
+
+func (b *bytesWriter) Write(data []byte) error {
+	if len(b.data)+len(data) > maxBytesFileSize {
+		return fmt.Errorf("content exceeds limit %d", maxBytesFileSize)
+	}
+	b.data = append(b.data, data...)
+	return nil
+}
+
+// ReadBytes - read whole remote file into memory, encrypted files are decrypted and compressed files
+// decompressed. Content is passed through a pipe and isn't stored on disk, decompression stops once
+// the content exceeds the limit.
+func (a *Allocation) ReadBytes(remotePath string) ([]byte, error) {
+	fileMeta, err := a.sdkAllocation.GetFileMeta(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	if fileMeta.Size > maxBytesFileSize {
+		return nil, fmt.Errorf("file size %d exceeds limit %d", fileMeta.Size, maxBytesFileSize)
+	}
+	content := &bytesWriter{}
+	w := newStatusWaiter(nil)
+	if _, err = a.downloadFileToWriter(fileMeta, content, w); err != nil {
+		return nil, err
+	}
+	if err = w.wait(); err != nil {
+		return nil, err
+	}
+	return content.data, nil
+}
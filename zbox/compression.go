@@ -0,0 +1,510 @@
+package zbox
+
+import (
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	l "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	"github.com/h2non/filetype"
+)
+
+// Compression codecs
+const (
+	// CompressionGzip - gzip codec
+	CompressionGzip = "gzip"
+)
+
+// compressionRoot - hidden allocation dir keeping compression records. Sdk file attributes hold only
+// WhoPaysForReads, so the codec is recorded out of band by a file named
+// <content hash>.<codec>.<size>.<plain hash>, where content hash is the hash of the stored compressed
+// content and size and plain hash describe the original file. Records are found by content hash, so they
+// stay valid when the file is renamed, moved, copied, versioned or trashed, and all of them are read
+// by a single listing. Owner's records can't be listed with auth ticket, shared files are read as stored.
+const compressionRoot = "/.compression"
+
+type compressionCodec struct {
+	compress   func(w io.Writer) io.WriteCloser
+	decompress func(r io.Reader) (io.ReadCloser, error)
+}
+
+var compressionCodecs = map[string]*compressionCodec{
+	CompressionGzip: {
+		compress: func(w io.Writer) io.WriteCloser {
+			return gzip.NewWriter(w)
+		},
+		decompress: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+}
+
+// compressionRecord - codec and original content of stored compressed file
+type compressionRecord struct {
+	Hash      string `json:"hash"`
+	Codec     string `json:"codec"`
+	Size      int64  `json:"size"`
+	PlainHash string `json:"plain_hash"`
+}
+
+func (r *compressionRecord) name() string {
+	return fmt.Sprintf("%s.%s.%d.%s", r.Hash, r.Codec, r.Size, r.PlainHash)
+}
+
+func (r *compressionRecord) codec() *compressionCodec {
+	return compressionCodecs[r.Codec]
+}
+
+// parseCompressionRecord parses record file name, names of other files and unknown codecs are skipped
+func parseCompressionRecord(name string) (*compressionRecord, bool) {
+	parts := strings.Split(name, ".")
+	if len(parts) != 4 || len(parts[0]) == 0 || len(parts[3]) == 0 {
+		return nil, false
+	}
+	if _, ok := compressionCodecs[parts[1]]; !ok {
+		return nil, false
+	}
+	size, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || size < 0 {
+		return nil, false
+	}
+	return &compressionRecord{Hash: parts[0], Codec: parts[1], Size: size, PlainHash: parts[3]}, true
+}
+
+// compressionRecords lists compression records by content hash, failed listing isn't taken for missing records
+func (a *Allocation) compressionRecords() (map[string]*compressionRecord, error) {
+	records := make(map[string]*compressionRecord)
+	listResult, err := a.sdkAllocation.ListDir(compressionRoot)
+	if err == nil && len(listResult.Path) > 0 {
+		for _, child := range listResult.Children {
+			if r, ok := parseCompressionRecord(child.Name); ok {
+				records[r.Hash] = r
+			}
+		}
+		return records, nil
+	}
+	fileMeta, err := a.remoteFileMeta(compressionRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list compression records. %v", err)
+	}
+	if fileMeta != nil {
+		return nil, fmt.Errorf("failed to list compression records")
+	}
+	return records, nil
+}
+
+// compressionRecord returns record of stored content, nil for plain content
+func (a *Allocation) compressionRecord(hash string) (*compressionRecord, error) {
+	if len(hash) == 0 {
+		return nil, nil
+	}
+	records, err := a.compressionRecords()
+	if err != nil {
+		return nil, err
+	}
+	return records[hash], nil
+}
+
+// saveCompressionRecord uploads record unless the same content was recorded before
+func (a *Allocation) saveCompressionRecord(r *compressionRecord) error {
+	records, err := a.compressionRecords()
+	if err != nil {
+		return err
+	}
+	if _, ok := records[r.Hash]; ok {
+		return nil
+	}
+	if err = a.ensureRemoteDir(compressionRoot); err != nil {
+		return err
+	}
+	dir, err := newSpoolDir("record")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	localPath := filepath.Join(dir, r.name())
+	if err = ioutil.WriteFile(localPath, data, 0600); err != nil {
+		return err
+	}
+	w := newStatusWaiter(nil)
+	err = a.sdkAllocation.UploadFile(localPath, path.Join(compressionRoot, r.name()), fileref.Attributes{}, w)
+	if err == nil {
+		err = w.wait()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save compression record. %v", err)
+	}
+	return nil
+}
+
+// compressFile compresses localPath into spool dir keeping remote name, returned dir has to be removed by caller
+func compressFile(localPath, remotePath, codecName string) (*compressionRecord, string, string, error) {
+	codec, ok := compressionCodecs[codecName]
+	if !ok {
+		return nil, "", "", fmt.Errorf("unsupported compression %s", codecName)
+	}
+	in, err := os.Open(localPath)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer in.Close()
+	dir, err := newSpoolDir("compress")
+	if err != nil {
+		return nil, "", "", err
+	}
+	compressedPath := filepath.Join(dir, path.Base(remotePath))
+	r := &compressionRecord{Codec: codecName}
+	err = func() error {
+		out, err := os.OpenFile(compressedPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		plainHash, hash := sha1.New(), sha1.New()
+		cw := codec.compress(io.MultiWriter(out, hash))
+		if r.Size, err = io.Copy(cw, io.TeeReader(in, plainHash)); err != nil {
+			return err
+		}
+		if err = cw.Close(); err != nil {
+			return err
+		}
+		r.Hash, r.PlainHash = hex.EncodeToString(hash.Sum(nil)), hex.EncodeToString(plainHash.Sum(nil))
+		return out.Sync()
+	}()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", "", fmt.Errorf("failed to compress %s. %v", localPath, err)
+	}
+	return r, compressedPath, dir, nil
+}
+
+// decompressFile decompresses downloaded file in place and checks the original content hash
+func decompressFile(localPath string, r *compressionRecord) error {
+	in, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmpPath := localPath + ".decompress"
+	err = func() error {
+		rc, err := r.codec().decompress(in)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		out, err := os.Create(tmpPath)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		h := sha1.New()
+		if _, err = io.Copy(io.MultiWriter(out, h), rc); err != nil {
+			return err
+		}
+		if hash := hex.EncodeToString(h.Sum(nil)); hash != r.PlainHash {
+			return fmt.Errorf("content hash %s doesn't match %s", hash, r.PlainHash)
+		}
+		return out.Sync()
+	}()
+	if err == nil {
+		err = os.Rename(tmpPath, localPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to decompress %s. %v", localPath, err)
+	}
+	return nil
+}
+
+// contentMimeType detects mime type from head of the content like sdk does
+func contentMimeType(head []byte) string {
+	kind, _ := filetype.Match(head)
+	if kind == filetype.Unknown {
+		return "application/octet-stream"
+	}
+	return kind.MIME.Value
+}
+
+func fileMimeType(localPath string) string {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, mimeSniffSize)
+	n, _ := io.ReadFull(f, head)
+	return contentMimeType(head[:n])
+}
+
+// decompressStatus decompresses downloaded file before completion is reported. Compression record is
+// looked up by content hash of the downloaded file once download is completed.
+type decompressStatus struct {
+	StatusCallback
+	a         *Allocation
+	localPath string
+}
+
+func (s *decompressStatus) Completed(allocationID, filePath string, filename string, mimetype string, size int, op int) {
+	localPath := s.localPath
+	if fi, err := os.Stat(localPath); err == nil && fi.IsDir() {
+		localPath = filepath.Join(localPath, filename)
+	}
+	r, err := s.downloadedRecord(localPath)
+	if err == nil && r != nil {
+		err = decompressFile(localPath, r)
+		size, mimetype = int(r.Size), fileMimeType(localPath)
+	}
+	if err != nil {
+		os.Remove(localPath)
+		s.StatusCallback.Error(allocationID, filePath, op, err)
+		return
+	}
+	s.StatusCallback.Completed(allocationID, filePath, filename, mimetype, size, op)
+}
+
+func (s *decompressStatus) downloadedRecord(localPath string) (*compressionRecord, error) {
+	records, err := s.a.compressionRecords()
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	hash, err := fileSha1(localPath)
+	if err != nil {
+		return nil, err
+	}
+	return records[hash], nil
+}
+
+// plainReader - seekable view of decompressed content of stored compressed file. Stored blocks are
+// downloaded only as far as decompression reads, seeking back starts decompression from the start.
+type plainReader struct {
+	stored *streamReader
+	record *compressionRecord
+	offset int64
+
+	rc io.ReadCloser
+	// pos - offset of rc in decompressed content
+	pos int64
+}
+
+// newPlainReader reads stored blocks through cache, files read once use a small cache of their own
+func newPlainReader(cache *blockCache, f *streamFile, r *compressionRecord) *plainReader {
+	if cache == nil {
+		cache = newBlockCache(streamReadAheadBlocks)
+	}
+	return &plainReader{stored: &streamReader{cache: cache, f: f}, record: r}
+}
+
+func (r *plainReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.record.Size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *plainReader) Read(p []byte) (int, error) {
+	if r.offset >= r.record.Size {
+		return 0, io.EOF
+	}
+	if r.rc == nil || r.pos > r.offset {
+		if err := r.restart(); err != nil {
+			return 0, err
+		}
+	}
+	if r.pos < r.offset {
+		n, err := io.CopyN(ioutil.Discard, r.rc, r.offset-r.pos)
+		r.pos += n
+		if err != nil {
+			return 0, fmt.Errorf("failed to decompress content. %v", err)
+		}
+	}
+	n, err := r.rc.Read(p)
+	r.pos += int64(n)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.record.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *plainReader) restart() error {
+	r.Close()
+	if _, err := r.stored.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	rc, err := r.record.codec().decompress(r.stored)
+	if err != nil {
+		return fmt.Errorf("failed to decompress content. %v", err)
+	}
+	r.rc, r.pos = rc, 0
+	return nil
+}
+
+func (r *plainReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
+
+// progressWriter reports written bytes to operation and stops once it's cancelled
+type progressWriter struct {
+	w       io.Writer
+	op      *Operation
+	path    string
+	written int
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	if pw.op.isCancelled() {
+		return 0, fmt.Errorf("download cancelled")
+	}
+	n, err := pw.w.Write(p)
+	pw.written += n
+	pw.op.InProgress(pw.op.allocationID, pw.path, sdk.OpDownload, pw.written, nil)
+	return n, err
+}
+
+// downloadCompressedBlocks writes requested blocks of decompressed content, endBlock 0 is the last block.
+// Only stored blocks preceding the end of the range are downloaded.
+func (a *Allocation) downloadCompressedBlocks(fileMeta *sdk.ConsolidatedFileMeta, r *compressionRecord, localPath string, startBlock, endBlock int64, op *Operation) {
+	if fi, err := os.Stat(localPath); err == nil && fi.IsDir() {
+		localPath = filepath.Join(localPath, fileMeta.Name)
+	}
+	err := writePlainBlocks(fileMeta, r, a.fileBlockDownloader(fileMeta.Path), blockContentSize(a.DataShards, len(fileMeta.EncryptedKey) > 0), localPath, startBlock, endBlock, op)
+	if err != nil {
+		op.Error(a.ID, fileMeta.Path, sdk.OpDownload, err)
+		return
+	}
+	fi, err := os.Stat(localPath)
+	if err != nil {
+		op.Error(a.ID, fileMeta.Path, sdk.OpDownload, err)
+		return
+	}
+	op.Completed(a.ID, fileMeta.Path, fileMeta.Name, fileMimeType(localPath), int(fi.Size()), sdk.OpDownload)
+}
+
+// writePlainBlocks writes blocks of decompressed content into new local file, which is removed on failure
+func writePlainBlocks(fileMeta *sdk.ConsolidatedFileMeta, r *compressionRecord, download blockDownloader, blockSize int64, localPath string, startBlock, endBlock int64, op *Operation) error {
+	if startBlock < 1 || (endBlock > 0 && endBlock < startBlock) {
+		return fmt.Errorf("invalid block range %d-%d", startBlock, endBlock)
+	}
+	offset := (startBlock - 1) * blockSize
+	length := r.Size - offset
+	if endBlock > 0 && (endBlock-startBlock+1)*blockSize < length {
+		length = (endBlock - startBlock + 1) * blockSize
+	}
+	if length < 0 {
+		length = 0
+	}
+	out, err := os.OpenFile(localPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	op.Started(op.allocationID, fileMeta.Path, sdk.OpDownload, int(length))
+	plain := newPlainReader(nil, &streamFile{token: newOperationID(), meta: fileMeta, blockSize: blockSize, download: download}, r)
+	defer plain.Close()
+	_, err = plain.Seek(offset, io.SeekStart)
+	if err == nil {
+		_, err = io.CopyN(&progressWriter{w: out, op: op, path: fileMeta.Path}, plain, length)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(localPath)
+	}
+	return err
+}
+
+// putCompressed compresses local file, records its codec and puts the copy, which is removed once upload
+// is finished. Compression runs before encryption as sdk encrypts the uploaded copy.
+func (a *Allocation) putCompressed(localPath, remotePath string, opts *PutOptions, statusCb StatusCallback) (*Operation, error) {
+	if opts.Mode == PutModeSkipUnchanged {
+		// remote file is compared with the original content
+		fileMeta, unchanged, err := a.remoteUnchanged(localPath, remotePath)
+		if err != nil {
+			return nil, err
+		}
+		if unchanged {
+			return a.skipUnchanged(localPath, remotePath, fileMeta, statusCb), nil
+		}
+		opts.Mode = PutModeCreate
+		if fileMeta != nil {
+			opts.Mode = PutModeUpdate
+		}
+	}
+	dirs := []string{}
+	cleanup := func() {
+		for _, dir := range dirs {
+			if err := os.RemoveAll(dir); err != nil {
+				l.Logger.Error("failed to remove compressed copy: ", err)
+			}
+		}
+	}
+	if opts.GenerateThumbnail != nil && len(opts.ThumbnailPath) == 0 {
+		// thumbnail is generated from the original image
+		thumbnailPath, dir, err := newThumbnail(localPath, opts.GenerateThumbnail)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, dir)
+		opts.ThumbnailPath = thumbnailPath
+	}
+	r, compressedPath, dir, err := compressFile(localPath, remotePath, opts.Compression)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	dirs = append(dirs, dir)
+	// record is saved first, content uploaded without it would be read compressed
+	if err = a.saveCompressionRecord(r); err != nil {
+		cleanup()
+		return nil, err
+	}
+	opts.Compression = ""
+	options, err := json.Marshal(opts)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	w := newStatusWaiter(statusCb)
+	op, err := a.Put(compressedPath, remotePath, string(options), w)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	// copy is removed on pause too, so compressed uploads can't be restarted by ID
+	op.pause = nil
+	go func() {
+		w.wait()
+		cleanup()
+	}()
+	return op, nil
+}
@@ -0,0 +1,219 @@
+package zbox
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+// newTestCompressedFile compresses content and serves its stored blocks padded to block size like blobbers do
+func newTestCompressedFile(content []byte, blockSize int64) (*sdk.ConsolidatedFileMeta, *compressionRecord, blockDownloader, *int) {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	gw.Write(content)
+	gw.Close()
+	stored := buf.Bytes()
+	plainHash := sha1.Sum(content)
+	storedHash := sha1.Sum(stored)
+	fileMeta := &sdk.ConsolidatedFileMeta{Name: "file.txt", Path: "/file.txt", Size: int64(len(stored)), Hash: hex.EncodeToString(storedHash[:])}
+	r := &compressionRecord{Hash: fileMeta.Hash, Codec: CompressionGzip, Size: int64(len(content)), PlainHash: hex.EncodeToString(plainHash[:])}
+	downloaded := 0
+	download := func(localPath string, startBlock, endBlock int64, cb StatusCallback) error {
+		data := make([]byte, (endBlock-startBlock+1)*blockSize)
+		copy(data, stored[(startBlock-1)*blockSize:])
+		downloaded += int(endBlock - startBlock + 1)
+		go func() {
+			if err := ioutil.WriteFile(localPath, data, 0644); err != nil {
+				cb.Error("", "", 0, err)
+				return
+			}
+			cb.Completed("", "", "", "", len(data), 0)
+		}()
+		return nil
+	}
+	return fileMeta, r, download, &downloaded
+}
+
+func testContent() []byte {
+	content := &bytes.Buffer{}
+	for i := 0; content.Len() < 200*1024; i++ {
+		fmt.Fprintf(content, "line %d %x\n", i, sha1.Sum([]byte(fmt.Sprint(i))))
+	}
+	return content.Bytes()
+}
+
+func TestParseCompressionRecord(t *testing.T) {
+	r := &compressionRecord{Hash: "aa11", Codec: CompressionGzip, Size: 1234, PlainHash: "bb22"}
+	parsed, ok := parseCompressionRecord(r.name())
+	if !ok || *parsed != *r {
+		t.Fatalf("expected %+v, got %+v", r, parsed)
+	}
+	for _, name := range []string{"aa11.zstd.1234.bb22", "aa11.gzip.x.bb22", "aa11.gzip.1234", "notes.txt", ".gzip.1.bb22"} {
+		if _, ok := parseCompressionRecord(name); ok {
+			t.Fatalf("%s parsed as record", name)
+		}
+	}
+}
+
+func TestPlainReaderSeek(t *testing.T) {
+	content := testContent()
+	fileMeta, r, download, _ := newTestCompressedFile(content, 16)
+	plain := newPlainReader(nil, &streamFile{token: "token", meta: fileMeta, blockSize: 16, download: download}, r)
+	defer plain.Close()
+
+	// reading back restarts decompression
+	for _, offset := range []int64{100, 3000, 7, 0} {
+		if _, err := plain.Seek(offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, 50)
+		if _, err := io.ReadFull(plain, data); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, content[offset:offset+50]) {
+			t.Fatalf("unexpected content at %d: %q", offset, data)
+		}
+	}
+	if size, err := plain.Seek(0, io.SeekEnd); err != nil || size != int64(len(content)) {
+		t.Fatalf("expected size %d, got %d %v", len(content), size, err)
+	}
+	if _, err := plain.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF at the end, got %v", err)
+	}
+}
+
+func TestWritePlainBlocks(t *testing.T) {
+	content := testContent()
+	dir, err := ioutil.TempDir("", "blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := &Allocation{ID: "alloc"}
+
+	fileMeta, r, download, downloaded := newTestCompressedFile(content, 1024)
+	localPath := filepath.Join(dir, "first")
+	op := a.newOperation(OpTypeDownload, localPath, fileMeta.Path, nil)
+	if err = writePlainBlocks(fileMeta, r, download, 1024, localPath, 2, 3, op); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content[1024:3072]) {
+		t.Fatalf("unexpected blocks content %q", data)
+	}
+	// decompression stops at the end of the range
+	if storedBlocks := (fileMeta.Size-1)/1024 + 1; int64(*downloaded) >= storedBlocks {
+		t.Fatalf("downloaded all %d stored blocks for the first blocks", storedBlocks)
+	}
+
+	// endBlock 0 is the last block
+	localPath = filepath.Join(dir, "last")
+	fileMeta, r, download, _ = newTestCompressedFile(content, 50000)
+	if err = writePlainBlocks(fileMeta, r, download, 50000, localPath, 4, 0, op); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = ioutil.ReadFile(localPath); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content[150000:]) {
+		t.Fatalf("unexpected last block content %q", data)
+	}
+
+	// existing file isn't overwritten
+	if err = writePlainBlocks(fileMeta, r, download, 50000, localPath, 1, 1, op); err == nil {
+		t.Fatal("expected existing local file to be refused")
+	}
+}
+
+func TestDecompressFileChecksHash(t *testing.T) {
+	content := testContent()
+	dir, err := ioutil.TempDir("", "decompress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localPath := filepath.Join(dir, "file.txt")
+	if err = ioutil.WriteFile(localPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, compressedPath, spool, err := compressFile(localPath, "/file.txt", CompressionGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(spool)
+	if hash, _ := fileSha1(compressedPath); hash != r.Hash || r.Size != int64(len(content)) {
+		t.Fatalf("unexpected record %+v", r)
+	}
+
+	if err = decompressFile(compressedPath, r); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(compressedPath); !bytes.Equal(data, content) {
+		t.Fatal("decompressed content doesn't match")
+	}
+	// decompressed file is kept as is when content doesn't match the record
+	r, compressedPath, spool2, err := compressFile(localPath, "/file.txt", CompressionGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(spool2)
+	r.PlainHash = "00"
+	if err = decompressFile(compressedPath, r); err == nil {
+		t.Fatal("expected hash mismatch")
+	}
+	if hash, _ := fileSha1(compressedPath); hash != r.Hash {
+		t.Fatal("stored content was changed")
+	}
+}
+
+func TestVerifyContentOfCompressedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	content := testContent()
+	fileMeta, r, _, _ := newTestCompressedFile(content, 16)
+	localPath := filepath.Join(dir, "file.txt")
+	if err = ioutil.WriteFile(localPath, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = verifyContent(localPath, fileMeta.Hash, r); err != nil {
+		t.Fatalf("expected decompressed content to match, got %v", err)
+	}
+	// without record decompressed content doesn't match stored hash
+	if _, ok := verifyContent(localPath, fileMeta.Hash, nil).(*IntegrityError); !ok {
+		t.Fatal("expected stored hash mismatch")
+	}
+
+	if err = ioutil.WriteFile(localPath, content[:len(content)-1], 0600); err != nil {
+		t.Fatal(err)
+	}
+	e, ok := verifyContent(localPath, fileMeta.Hash, r).(*IntegrityError)
+	if !ok || e.ExpectedSize != int64(len(content)) || e.ActualSize != int64(len(content)-1) {
+		t.Fatalf("expected size mismatch, got %v", e)
+	}
+
+	changed := append([]byte{}, content...)
+	changed[0]++
+	if err = ioutil.WriteFile(localPath, changed, 0600); err != nil {
+		t.Fatal(err)
+	}
+	e, ok = verifyContent(localPath, fileMeta.Hash, r).(*IntegrityError)
+	if !ok || e.ExpectedHash != r.PlainHash {
+		t.Fatalf("expected plain hash mismatch, got %v", e)
+	}
+}
@@ -0,0 +1,251 @@
+package zbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+// DirDownloadOptions - options for directory download
+type DirDownloadOptions struct {
+	// Concurrency - number of files downloaded at once
+	Concurrency int `json:"concurrency,omitempty"`
+	// Overwrite - download files even when local file hash matches remote one
+	Overwrite bool `json:"overwrite,omitempty"`
+	// RxPay - reader pays for download, auth ticket downloads only
+	RxPay bool `json:"rx_pay,omitempty"`
+}
+
+// DownloadItem - single file of directory download
+type DownloadItem struct {
+	Index      int    `json:"index"`
+	RemotePath string `json:"remote_path"`
+	LocalPath  string `json:"local_path"`
+	Size       int64  `json:"size"`
+	Error      string `json:"error,omitempty"`
+
+	lookupHash string
+	name       string
+	hash       string
+}
+
+// DownloadReport - final report of directory download
+type DownloadReport struct {
+	TotalBytes int64 `json:"total_bytes"`
+	// DownloadedBytes - size of downloaded files
+	DownloadedBytes int64 `json:"downloaded_bytes"`
+	// SkippedBytes - size of files skipped as matching local ones
+	SkippedBytes int64           `json:"skipped_bytes"`
+	Downloaded   []*DownloadItem `json:"downloaded"`
+	Skipped      []*DownloadItem `json:"skipped"`
+	Failed       []*DownloadItem `json:"failed"`
+}
+
+type dirDownload struct {
+	a          *Allocation
+	opts       *DirDownloadOptions
+	authTicket string
+	cb         BatchStatusCallback
+	items      []*DownloadItem
+	// records - compression records, compressed files are compared and counted by original content
+	records map[string]*compressionRecord
+
+	progress   *batchProgress
+	totalBytes int64
+
+	mu     sync.Mutex
+	report *DownloadReport
+}
+
+// DownloadDirectory - download remote directory to local directory recreating the tree.
+// options is DirDownloadOptions JSON; files already matching by hash are skipped.
+func (a *Allocation) DownloadDirectory(remoteDir, localDir, options string, cb BatchStatusCallback) error {
+	opts, err := parseDirDownloadOptions(options)
+	if err != nil {
+		return err
+	}
+	d := &dirDownload{a: a, opts: opts, cb: cb}
+	if d.records, err = a.compressionRecords(); err != nil {
+		return err
+	}
+	if err = d.list(remoteDir, localDir); err != nil {
+		return err
+	}
+	return d.start()
+}
+
+// DownloadDirectoryFromAuthTicket - download shared directory to local directory recreating the tree,
+// shared compressed files are downloaded as stored
+func (a *Allocation) DownloadDirectoryFromAuthTicket(authTicket, lookupHash, localDir, options string, cb BatchStatusCallback) error {
+	opts, err := parseDirDownloadOptions(options)
+	if err != nil {
+		return err
+	}
+	d := &dirDownload{a: a, opts: opts, authTicket: authTicket, cb: cb}
+	if err = d.listFromAuthTicket(lookupHash, "/", localDir); err != nil {
+		return err
+	}
+	return d.start()
+}
+
+func parseDirDownloadOptions(options string) (*DirDownloadOptions, error) {
+	opts := &DirDownloadOptions{}
+	if len(options) > 0 {
+		err := json.Unmarshal([]byte(options), opts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid directory download options JSON. %v", err)
+		}
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultBatchConcurrency
+	}
+	return opts, nil
+}
+
+func (d *dirDownload) list(remoteDir, localDir string) error {
+	listResult, err := d.a.sdkAllocation.ListDir(remoteDir)
+	if err != nil {
+		return err
+	}
+	withoutHidden(listResult)
+	return d.addChildren(listResult, localDir, func(child *sdk.ListResult, childLocal string) error {
+		return d.list(child.Path, childLocal)
+	})
+}
+
+func (d *dirDownload) listFromAuthTicket(lookupHash, remoteDir, localDir string) error {
+	listResult, err := d.a.sdkAllocation.ListDirFromAuthTicket(d.authTicket, lookupHash)
+	if err != nil {
+		return err
+	}
+	for _, child := range listResult.Children {
+		if len(child.Path) == 0 {
+			child.Path = filepath.ToSlash(filepath.Join(remoteDir, child.Name))
+		}
+	}
+	return d.addChildren(listResult, localDir, func(child *sdk.ListResult, childLocal string) error {
+		return d.listFromAuthTicket(child.LookupHash, child.Path, childLocal)
+	})
+}
+
+func (d *dirDownload) addChildren(listResult *sdk.ListResult, localDir string, listDir func(*sdk.ListResult, string) error) error {
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return err
+	}
+	for _, child := range listResult.Children {
+		childLocal := filepath.Join(localDir, child.Name)
+		if child.Type == "d" {
+			if err := listDir(child, childLocal); err != nil {
+				return err
+			}
+			continue
+		}
+		item := &DownloadItem{
+			Index:      len(d.items),
+			RemotePath: child.Path,
+			LocalPath:  childLocal,
+			Size:       child.ActualSize,
+			lookupHash: child.LookupHash,
+			name:       child.Name,
+			hash:       child.Hash,
+		}
+		if r, ok := d.records[child.Hash]; ok {
+			item.Size, item.hash = r.Size, r.PlainHash
+		}
+		d.items = append(d.items, item)
+		d.totalBytes += item.Size
+	}
+	return nil
+}
+
+func (d *dirDownload) start() error {
+	if len(d.items) == 0 {
+		return fmt.Errorf("no files to download")
+	}
+	d.progress = newBatchProgress(d.cb, len(d.items), d.totalBytes)
+	d.report = &DownloadReport{
+		TotalBytes: d.totalBytes,
+		Downloaded: []*DownloadItem{},
+		Skipped:    []*DownloadItem{},
+		Failed:     []*DownloadItem{},
+	}
+	go d.run()
+	return nil
+}
+
+func (d *dirDownload) run() {
+	sem := make(chan struct{}, d.opts.Concurrency)
+	wg := &sync.WaitGroup{}
+	for _, item := range d.items {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(item *DownloadItem) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			d.downloadItem(item)
+		}(item)
+	}
+	wg.Wait()
+	retBytes, err := json.Marshal(d.report)
+	if err != nil {
+		retBytes = []byte("{}")
+	}
+	d.cb.BatchCompleted(string(retBytes))
+}
+
+func (d *dirDownload) downloadItem(item *DownloadItem) {
+	if !d.opts.Overwrite && len(item.hash) > 0 {
+		if localHash, err := fileSha1(item.LocalPath); err == nil && localHash == item.hash {
+			d.finish(item, &d.report.Skipped, &d.report.SkippedBytes, nil)
+			return
+		}
+	}
+	// downloader refuses to overwrite existing files
+	os.Remove(item.LocalPath)
+
+	w := newStatusWaiter(nil)
+	w.onStarted = func(totalBytes int) {
+		d.cb.ItemStarted(item.Index, item.RemotePath, int64(totalBytes))
+	}
+	w.onProgress = func(completedBytes int) {
+		d.progress.set(item.Index, int64(completedBytes))
+		d.cb.ItemProgress(item.Index, item.RemotePath, int64(completedBytes))
+	}
+	var err error
+	if len(d.authTicket) > 0 {
+		_, err = d.a.DownloadFromAuthTicket(item.LocalPath, d.authTicket, item.lookupHash, item.name, d.opts.RxPay, w)
+	} else {
+		_, err = d.a.DownloadFile(item.RemotePath, item.LocalPath, w)
+	}
+	if err == nil {
+		err = w.wait()
+	}
+	if err != nil {
+		d.finish(item, &d.report.Failed, nil, err)
+		return
+	}
+	d.finish(item, &d.report.Downloaded, &d.report.DownloadedBytes, nil)
+}
+
+// finish adds item to report list and its size to report bytes when set
+func (d *dirDownload) finish(item *DownloadItem, list *[]*DownloadItem, bytes *int64, err error) {
+	if err != nil {
+		item.Error = err.Error()
+		d.cb.ItemError(item.Index, item.RemotePath, err)
+	} else {
+		d.cb.ItemCompleted(item.Index, item.RemotePath)
+	}
+	d.mu.Lock()
+	*list = append(*list, item)
+	if bytes != nil {
+		*bytes += item.Size
+	}
+	d.mu.Unlock()
+	d.progress.done(item.Index, item.Size)
+}
@@ -0,0 +1,155 @@
+package zbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// DirUploadOptions - options for directory upload
+type DirUploadOptions struct {
+	// Workdir - work dir for chunked upload
+	Workdir string `json:"workdir"`
+	// Include - glob patterns of files to upload, all files if empty
+	Include []string `json:"include,omitempty"`
+	// Exclude - glob patterns of files and dirs to skip
+	Exclude []string `json:"exclude,omitempty"`
+	// FollowSymlinks - upload symlink targets instead of skipping symlinks
+	FollowSymlinks bool `json:"follow_symlinks,omitempty"`
+	// Concurrency - number of files uploaded at once
+	Concurrency int `json:"concurrency,omitempty"`
+	// Attributes - file attributes applied to every file
+	Attributes json.RawMessage `json:"attributes,omitempty"`
+	// SkipUnchanged - skip files whose remote copy has the same content hash, update changed ones
+	SkipUnchanged bool `json:"skip_unchanged,omitempty"`
+}
+
+type dirWalker struct {
+	opts    *DirUploadOptions
+	visited map[string]bool
+	dirs    []string
+	items   []*UploadSpec
+}
+
+// CreateDir - create directory in remote path
+func (a *Allocation) CreateDir(remotePath string) error {
+	return a.sdkAllocation.CreateDir(remotePath)
+}
+
+// UploadDirectory - upload local directory to remote directory preserving structure.
+// options is DirUploadOptions JSON; files are uploaded with chunked upload and reported with cb.
+func (a *Allocation) UploadDirectory(localDir, remoteDir, options string, cb BatchStatusCallback) error {
+	opts := &DirUploadOptions{}
+	if len(options) > 0 {
+		err := json.Unmarshal([]byte(options), opts)
+		if err != nil {
+			return fmt.Errorf("invalid directory upload options JSON. %v", err)
+		}
+	}
+	for _, pattern := range append(opts.Include, opts.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern %s. %v", pattern, err)
+		}
+	}
+	fi, err := os.Stat(localDir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", localDir)
+	}
+
+	w := &dirWalker{opts: opts, visited: make(map[string]bool)}
+	if err = w.walk(localDir, remoteDir, ""); err != nil {
+		return err
+	}
+	if len(w.items) == 0 {
+		return fmt.Errorf("no files to upload in %s", localDir)
+	}
+
+	spec := &BatchSpec{Workdir: opts.Workdir, Concurrency: opts.Concurrency, Items: w.items}
+	if spec.Concurrency <= 0 {
+		spec.Concurrency = 1
+	}
+	b, err := newUploadBatch(a, spec, cb)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for _, dir := range w.dirs {
+			if err := a.CreateDir(dir); err != nil {
+				l.Logger.Error("create dir ", dir, " failed: ", err)
+			}
+		}
+		b.run()
+	}()
+	return nil
+}
+
+// walk collects dirs and files of localDir, rel is path relative to the upload root
+func (w *dirWalker) walk(localDir, remoteDir, rel string) error {
+	realDir, err := filepath.EvalSymlinks(localDir)
+	if err != nil {
+		return err
+	}
+	if w.visited[realDir] {
+		// symlink loop
+		return nil
+	}
+	w.visited[realDir] = true
+	w.dirs = append(w.dirs, remoteDir)
+
+	entries, err := ioutil.ReadDir(localDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		localPath := filepath.Join(localDir, entry.Name())
+		remotePath := path.Join(remoteDir, entry.Name())
+		relPath := path.Join(rel, entry.Name())
+		if matchAny(w.opts.Exclude, relPath, entry.Name()) || isHiddenPath(remotePath) {
+			continue
+		}
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if !w.opts.FollowSymlinks {
+				continue
+			}
+			if entry, err = os.Stat(localPath); err != nil {
+				l.Logger.Error("broken symlink ", localPath, ": ", err)
+				continue
+			}
+		}
+		if entry.IsDir() {
+			if err = w.walk(localPath, remotePath, relPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		if len(w.opts.Include) > 0 && !matchAny(w.opts.Include, relPath, entry.Name()) {
+			continue
+		}
+		w.items = append(w.items, &UploadSpec{LocalPath: localPath, RemotePath: remotePath, Attributes: w.opts.Attributes, SkipUnchanged: w.opts.SkipUnchanged})
+	}
+	return nil
+}
+
+// matchAny checks relative path and base name against glob patterns
+func matchAny(patterns []string, relPath, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, relPath); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package zbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/0chain/gosdk/zcncore"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// number of blocks and reward percentiles used for priority fee tiers
+const (
+	feeHistoryBlocks = 20
+	slowPercentile   = 10
+	normalPercentile = 50
+	fastPercentile   = 90
+)
+
+// rpcMethodNotFound - JSON-RPC error code of unknown method
+const rpcMethodNotFound = -32601
+
+// gas limits of known operations
+var ethOperationGas = map[string]uint64{
+	"eth_transfer":   21000,
+	"erc20_transfer": 65000,
+	"erc20_approve":  50000,
+	"bridge_burn":    150000,
+	"bridge_mint":    300000,
+}
+
+// EthFeeTier - fee for one of slow, normal or fast tiers
+type EthFeeTier struct {
+	PriorityFee string  `json:"priority_fee_wei"`
+	MaxFee      string  `json:"max_fee_wei"`
+	TotalEth    float64 `json:"total_eth"`
+	TotalZcn    float64 `json:"total_zcn,omitempty"`
+	MaxTotalEth float64 `json:"max_total_eth"`
+}
+
+// EthFeeEstimate - fee estimation for Ethereum operation
+type EthFeeEstimate struct {
+	EIP1559  bool                   `json:"eip1559"`
+	GasLimit uint64                 `json:"gas_limit"`
+	BaseFee  string                 `json:"base_fee_wei,omitempty"`
+	GasPrice string                 `json:"gas_price_wei,omitempty"`
+	Tiers    map[string]*EthFeeTier `json:"tiers"`
+}
+
+type feeHistory struct {
+	BaseFee []*hexutil.Big   `json:"baseFeePerGas"`
+	Reward  [][]*hexutil.Big `json:"reward"`
+}
+
+// EstimateEthFees - estimate fees of known operation (eth_transfer, erc20_transfer,
+// erc20_approve, bridge_burn, bridge_mint) on the eth node from config
+func (s *StorageSDK) EstimateEthFees(operation string) (string, error) {
+	gas, ok := ethOperationGas[operation]
+	if !ok {
+		return "", fmt.Errorf("unknown eth operation %s", operation)
+	}
+	return s.EstimateEthFeesForGas(int64(gas))
+}
+
+// EstimateEthFeesForGas - estimate fees of operation with gasLimit on the eth node from config
+func (s *StorageSDK) EstimateEthFeesForGas(gasLimit int64) (string, error) {
+	if len(s.chainconfig.EthNode) == 0 {
+		return "", fmt.Errorf("eth node is not set in config")
+	}
+	if gasLimit <= 0 {
+		return "", fmt.Errorf("invalid gas limit %d", gasLimit)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	rpcClient, err := rpc.DialContext(ctx, s.chainconfig.EthNode)
+	if err != nil {
+		return "", err
+	}
+	defer rpcClient.Close()
+
+	estimate, err := estimateEthFees(ctx, rpcClient, uint64(gasLimit))
+	if err != nil {
+		return "", err
+	}
+	// total in ZCN is best effort, rate may be unavailable
+	if ethPerZcn, err := zcncore.ConvertZcnTokenToETH(1); err == nil && ethPerZcn > 0 {
+		for _, tier := range estimate.Tiers {
+			tier.TotalZcn = tier.TotalEth / ethPerZcn
+		}
+	}
+	retBytes, err := json.Marshal(estimate)
+	if err != nil {
+		return "", err
+	}
+	return string(retBytes), nil
+}
+
+func estimateEthFees(ctx context.Context, rpcClient *rpc.Client, gasLimit uint64) (*EthFeeEstimate, error) {
+	var history feeHistory
+	err := rpcClient.CallContext(ctx, &history, "eth_feeHistory", hexutil.Uint64(feeHistoryBlocks), "latest",
+		[]int{slowPercentile, normalPercentile, fastPercentile})
+	if rpcErr, ok := err.(rpc.Error); ok && rpcErr.ErrorCode() == rpcMethodNotFound {
+		return estimateLegacyEthFees(ctx, rpcClient, gasLimit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fee history. %v", err)
+	}
+
+	// last base fee in history is the base fee of the next block, pre-London blocks have none or zero
+	var baseFee *big.Int
+	if len(history.BaseFee) > 0 && history.BaseFee[len(history.BaseFee)-1] != nil {
+		baseFee = history.BaseFee[len(history.BaseFee)-1].ToInt()
+	}
+	if baseFee == nil || baseFee.Sign() == 0 {
+		return estimateLegacyEthFees(ctx, rpcClient, gasLimit)
+	}
+	estimate := &EthFeeEstimate{
+		EIP1559:  true,
+		GasLimit: gasLimit,
+		BaseFee:  baseFee.String(),
+		Tiers:    make(map[string]*EthFeeTier),
+	}
+	for i, name := range []string{"slow", "normal", "fast"} {
+		tip := medianReward(history.Reward, i)
+		// max fee covers base fee doubling before inclusion
+		maxFee := new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), tip)
+		expected := new(big.Int).Add(baseFee, tip)
+		estimate.Tiers[name] = &EthFeeTier{
+			PriorityFee: tip.String(),
+			MaxFee:      maxFee.String(),
+			TotalEth:    weiToEth(new(big.Int).Mul(expected, new(big.Int).SetUint64(gasLimit))),
+			MaxTotalEth: weiToEth(new(big.Int).Mul(maxFee, new(big.Int).SetUint64(gasLimit))),
+		}
+	}
+	return estimate, nil
+}
+
+// estimateLegacyEthFees uses eth_gasPrice for networks without EIP-1559
+func estimateLegacyEthFees(ctx context.Context, rpcClient *rpc.Client, gasLimit uint64) (*EthFeeEstimate, error) {
+	var gasPrice hexutil.Big
+	err := rpcClient.CallContext(ctx, &gasPrice, "eth_gasPrice")
+	if err != nil {
+		return nil, err
+	}
+	price := gasPrice.ToInt()
+	total := weiToEth(new(big.Int).Mul(price, new(big.Int).SetUint64(gasLimit)))
+	estimate := &EthFeeEstimate{
+		GasLimit: gasLimit,
+		GasPrice: price.String(),
+		Tiers:    make(map[string]*EthFeeTier),
+	}
+	for _, name := range []string{"slow", "normal", "fast"} {
+		estimate.Tiers[name] = &EthFeeTier{
+			PriorityFee: "0",
+			MaxFee:      price.String(),
+			TotalEth:    total,
+			MaxTotalEth: total,
+		}
+	}
+	return estimate, nil
+}
+
+func medianReward(rewards [][]*hexutil.Big, idx int) *big.Int {
+	values := make([]*big.Int, 0, len(rewards))
+	for _, r := range rewards {
+		if idx < len(r) && r[idx] != nil {
+			values = append(values, r[idx].ToInt())
+		}
+	}
+	if len(values) == 0 {
+		return big.NewInt(0)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Cmp(values[j]) < 0 })
+	return values[len(values)/2]
+}
+
+func weiToEth(wei *big.Int) float64 {
+	eth, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(params.Ether)).Float64()
+	return eth
+}
@@ -0,0 +1,115 @@
+package zbox
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testLegacyEthService - eth namespace of node without eth_feeHistory
+type testLegacyEthService struct {
+	gasPrice int64
+}
+
+func (s *testLegacyEthService) GasPrice() *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(s.gasPrice))
+}
+
+// testLondonEthService - eth namespace of node with eth_feeHistory
+type testLondonEthService struct {
+	testLegacyEthService
+	history *feeHistory
+	err     error
+}
+
+func (s *testLondonEthService) FeeHistory(blocks hexutil.Uint64, newest string, percentiles []int) (*feeHistory, error) {
+	return s.history, s.err
+}
+
+func estimateTestEthFees(t *testing.T, service interface{}, gasLimit uint64) (*EthFeeEstimate, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	rpcClient, err := rpc.Dial(httpServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rpcClient.Close()
+	return estimateEthFees(context.Background(), rpcClient, gasLimit)
+}
+
+func testWei(values ...int64) []*hexutil.Big {
+	ret := make([]*hexutil.Big, len(values))
+	for i, v := range values {
+		ret[i] = (*hexutil.Big)(big.NewInt(v))
+	}
+	return ret
+}
+
+func TestMedianReward(t *testing.T) {
+	rewards := [][]*hexutil.Big{testWei(1, 10, 300), testWei(3, 30, 100), testWei(2, 20, 200), {nil}}
+	for idx, expected := range []int64{2, 20, 200} {
+		if median := medianReward(rewards, idx); median.Int64() != expected {
+			t.Fatalf("expected median %d of percentile %d, got %v", expected, idx, median)
+		}
+	}
+	if median := medianReward(nil, 0); median.Sign() != 0 {
+		t.Fatalf("expected zero reward without history, got %v", median)
+	}
+}
+
+func TestEstimateEthFeesTiers(t *testing.T) {
+	gwei := int64(1e9)
+	service := &testLondonEthService{history: &feeHistory{
+		BaseFee: testWei(90*gwei, 100*gwei),
+		Reward:  [][]*hexutil.Big{testWei(1*gwei, 2*gwei, 3*gwei), testWei(1*gwei, 4*gwei, 5*gwei), testWei(1*gwei, 2*gwei, 7*gwei)},
+	}}
+	estimate, err := estimateTestEthFees(t, service, 21000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !estimate.EIP1559 || estimate.BaseFee != fmt.Sprint(100*gwei) {
+		t.Fatalf("expected EIP-1559 estimate with next block base fee, got %+v", estimate)
+	}
+	normal := estimate.Tiers["normal"]
+	// max fee covers doubled base fee, total uses current base fee
+	if normal.PriorityFee != fmt.Sprint(2*gwei) || normal.MaxFee != fmt.Sprint(202*gwei) {
+		t.Fatalf("unexpected normal tier %+v", normal)
+	}
+	if normal.TotalEth != 0.002142 || normal.MaxTotalEth != 0.004242 {
+		t.Fatalf("unexpected normal tier totals %+v", normal)
+	}
+	if fast := estimate.Tiers["fast"]; fast.PriorityFee != fmt.Sprint(5*gwei) {
+		t.Fatalf("unexpected fast tier %+v", fast)
+	}
+}
+
+func TestEstimateEthFeesFallback(t *testing.T) {
+	// unknown eth_feeHistory and zero base fees fall back to gas price
+	for _, service := range []interface{}{
+		&testLegacyEthService{gasPrice: 5},
+		&testLondonEthService{testLegacyEthService: testLegacyEthService{gasPrice: 5}, history: &feeHistory{BaseFee: testWei(0, 0)}},
+	} {
+		estimate, err := estimateTestEthFees(t, service, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if estimate.EIP1559 || estimate.GasPrice != "5" || estimate.Tiers["fast"].MaxFee != "5" {
+			t.Fatalf("expected legacy estimate, got %+v", estimate)
+		}
+	}
+
+	// other errors aren't hidden behind legacy estimate
+	service := &testLondonEthService{testLegacyEthService: testLegacyEthService{gasPrice: 5}, err: fmt.Errorf("node is syncing")}
+	if estimate, err := estimateTestEthFees(t, service, 10); err == nil {
+		t.Fatalf("expected fee history error, got %+v", estimate)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package zbox
+
+import "syscall"
+
+func makeFifo(path string) error {
+	return syscall.Mkfifo(path, 0600)
+}
@@ -0,0 +1,7 @@
+package zbox
+
+import "fmt"
+
+func makeFifo(path string) error {
+	return fmt.Errorf("named pipes are not supported")
+}
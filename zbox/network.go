@@ -0,0 +1,267 @@
+package zbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	l "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+// Network states pushed by the host app
+const (
+	// NetworkUnknown - no state was reported yet, unmetered only transfers wait for it
+	NetworkUnknown   = "unknown"
+	NetworkUnmetered = "unmetered"
+	NetworkMetered   = "metered"
+	NetworkOffline   = "offline"
+)
+
+// Network constraints of transfers
+const (
+	// NetworkAny - transfer runs on any connected network
+	NetworkAny = "any"
+	// NetworkUnmeteredOnly - transfer runs on unmetered network only, e.g. Wi-Fi
+	NetworkUnmeteredOnly = "unmetered"
+)
+
+// TransferConstraints - conditions under which transfer may run
+type TransferConstraints struct {
+	// Network - any or unmetered, roaming should be reported by the host as metered
+	Network string `json:"network,omitempty"`
+}
+
+// constrainedTransfer - transfer paused and resumed by network policy
+type constrainedTransfer struct {
+	network  string
+	statusCb StatusCallback
+	op       *Operation
+	resume   func(statusCb StatusCallback) (*Operation, error)
+	pausing  bool
+	paused   bool
+}
+
+type networkPolicy struct {
+	mu        sync.Mutex
+	state     string
+	transfers map[*constrainedTransfer]struct{}
+}
+
+var network = &networkPolicy{state: NetworkUnknown, transfers: make(map[*constrainedTransfer]struct{})}
+
+func networkAllowed(constraint, state string) bool {
+	switch {
+	case state == NetworkOffline:
+		return false
+	case constraint == NetworkUnmeteredOnly:
+		return state == NetworkUnmetered
+	default:
+		return true
+	}
+}
+
+func checkNetworkAllowed(constraint string) error {
+	state := currentNetworkState()
+	if networkAllowed(constraint, state) {
+		return nil
+	}
+	if state == NetworkUnknown {
+		return fmt.Errorf("network state is unknown, it has to be reported by SetNetworkState")
+	}
+	return fmt.Errorf("network constraint %s is not satisfied", constraint)
+}
+
+func currentNetworkState() string {
+	network.mu.Lock()
+	defer network.mu.Unlock()
+	return network.state
+}
+
+func parseTransferConstraints(constraints string) (*TransferConstraints, error) {
+	c := &TransferConstraints{}
+	if len(constraints) > 0 {
+		if err := json.Unmarshal([]byte(constraints), c); err != nil {
+			return nil, fmt.Errorf("invalid transfer constraints JSON. %v", err)
+		}
+	}
+	switch c.Network {
+	case "", NetworkAny, NetworkUnmeteredOnly:
+	default:
+		return nil, fmt.Errorf("unknown network constraint %s", c.Network)
+	}
+	return c, nil
+}
+
+// setState pauses transfers violating constraints and resumes the ones allowed again
+func (p *networkPolicy) setState(state string) {
+	p.mu.Lock()
+	p.state = state
+	toPause := make([]*constrainedTransfer, 0)
+	toResume := make([]*constrainedTransfer, 0)
+	for ct := range p.transfers {
+		if !ct.paused && !ct.pausing && ct.op.isFinished() {
+			delete(p.transfers, ct)
+			continue
+		}
+		allowed := networkAllowed(ct.network, state)
+		if !allowed && !ct.paused && !ct.pausing {
+			ct.pausing = true
+			toPause = append(toPause, ct)
+		}
+		if allowed && ct.paused {
+			ct.paused = false
+			toResume = append(toResume, ct)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, ct := range toPause {
+		if err := ct.op.Pause(); err != nil {
+			l.Logger.Error("failed to pause ", ct.op.GetID(), ": ", err)
+			p.mu.Lock()
+			ct.pausing = false
+			p.mu.Unlock()
+		}
+	}
+	for _, ct := range toResume {
+		p.resume(ct)
+	}
+}
+
+// start runs transfer with callback reporting pause back to the policy
+func (p *networkPolicy) start(ct *constrainedTransfer, run func(statusCb StatusCallback) (*Operation, error)) (*Operation, error) {
+	w := newStatusWaiter(ct.statusCb)
+	w.onPaused = func() {
+		p.paused(ct)
+	}
+	op, err := run(w)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	ct.op = op
+	p.transfers[ct] = struct{}{}
+	p.mu.Unlock()
+	return op, nil
+}
+
+func (p *networkPolicy) paused(ct *constrainedTransfer) {
+	p.mu.Lock()
+	if !ct.pausing {
+		// paused by the app, it's not resumed by policy
+		delete(p.transfers, ct)
+		p.mu.Unlock()
+		return
+	}
+	ct.pausing = false
+	ct.paused = true
+	resume := networkAllowed(ct.network, p.state)
+	if resume {
+		ct.paused = false
+	}
+	p.mu.Unlock()
+	if resume {
+		p.resume(ct)
+	}
+}
+
+func (p *networkPolicy) resume(ct *constrainedTransfer) {
+	p.mu.Lock()
+	resume := ct.resume
+	p.mu.Unlock()
+	if _, err := p.start(ct, resume); err != nil {
+		l.Logger.Error("failed to resume transfer: ", err)
+		p.mu.Lock()
+		delete(p.transfers, ct)
+		p.mu.Unlock()
+		ct.statusCb.Error(ct.op.allocationID, ct.op.remotePath, opCode(ct.op.opType), err)
+	}
+}
+
+func opCode(opType string) int {
+	switch opType {
+	case OpTypeDownload:
+		return sdk.OpDownload
+	case OpTypeRepair:
+		return sdk.OpRepair
+	default:
+		return sdk.OpUpload
+	}
+}
+
+// SetNetworkState - report current network state: unmetered, metered or offline.
+// Transfers violating their constraints are paused and resumed when allowed again.
+// Until the first report the state is unknown and unmetered only jobs stay queued.
+func (s *StorageSDK) SetNetworkState(state string) error {
+	switch state {
+	case NetworkUnmetered, NetworkMetered, NetworkOffline:
+	default:
+		return fmt.Errorf("unknown network state %s", state)
+	}
+	network.setState(state)
+	s.queue.networkChanged(state)
+	return nil
+}
+
+// GetNetworkState - last network state reported by the host app, unknown until the first report
+func (s *StorageSDK) GetNetworkState() string {
+	return currentNetworkState()
+}
+
+// UploadFileConstrained - start chunked upload which is paused while network constraints are violated
+// and started again from the beginning when allowed. constraints is TransferConstraints JSON,
+// work_dir has to be set in config.
+func (a *Allocation) UploadFileConstrained(workdir, localPath, remotePath, fileAttrs, constraints string, statusCb StatusCallback) (*Operation, error) {
+	if len(workDir) == 0 {
+		return nil, fmt.Errorf("work_dir is not set in config")
+	}
+	c, err := parseTransferConstraints(constraints)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkNetworkAllowed(c.Network); err != nil {
+		return nil, err
+	}
+	id := uploadID(a.ID, localPath, remotePath)
+	ct := &constrainedTransfer{
+		network:  c.Network,
+		statusCb: statusCb,
+		resume: func(cb StatusCallback) (*Operation, error) {
+			return a.RestartUpload(id, cb)
+		},
+	}
+	return network.start(ct, func(cb StatusCallback) (*Operation, error) {
+		return a.UploadFile(workdir, localPath, remotePath, fileAttrs, cb)
+	})
+}
+
+// DownloadFileConstrained - start resumable download which is paused while network constraints are violated.
+// constraints is TransferConstraints JSON.
+func (a *Allocation) DownloadFileConstrained(remotePath, localPath, constraints string, statusCb StatusCallback) (*Operation, error) {
+	c, err := parseTransferConstraints(constraints)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkNetworkAllowed(c.Network); err != nil {
+		return nil, err
+	}
+	ct := &constrainedTransfer{
+		network:  c.Network,
+		statusCb: statusCb,
+	}
+	op, err := network.start(ct, func(cb StatusCallback) (*Operation, error) {
+		return a.DownloadFileResumable(remotePath, localPath, cb)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// download may be saved into directory, resume by resolved local path
+	resolvedPath := op.localPath
+	network.mu.Lock()
+	ct.resume = func(cb StatusCallback) (*Operation, error) {
+		return a.ResumeDownload(resolvedPath, cb)
+	}
+	network.mu.Unlock()
+	return op, nil
+}
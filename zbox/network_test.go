@@ -0,0 +1,24 @@
+package zbox
+
+import "testing"
+
+func TestNetworkAllowed(t *testing.T) {
+	tests := []struct {
+		constraint string
+		state      string
+		allowed    bool
+	}{
+		{NetworkAny, NetworkUnknown, true},
+		{NetworkAny, NetworkMetered, true},
+		{NetworkAny, NetworkOffline, false},
+		{NetworkUnmeteredOnly, NetworkUnknown, false},
+		{NetworkUnmeteredOnly, NetworkMetered, false},
+		{NetworkUnmeteredOnly, NetworkUnmetered, true},
+		{NetworkUnmeteredOnly, NetworkOffline, false},
+	}
+	for _, tt := range tests {
+		if allowed := networkAllowed(tt.constraint, tt.state); allowed != tt.allowed {
+			t.Errorf("networkAllowed(%s, %s) = %v, expected %v", tt.constraint, tt.state, allowed, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package zbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+// Operation types
+const (
+	OpTypeUpload   = "upload"
+	OpTypeDownload = "download"
+	OpTypeRepair   = "repair"
+)
+
+// Operation statuses
+const (
+	OpStatusPending   = "pending"
+	OpStatusRunning   = "running"
+	OpStatusPaused    = "paused"
+	OpStatusCompleted = "completed"
+	OpStatusFailed    = "failed"
+	OpStatusCancelled = "cancelled"
+)
+
+// finished operations are listed for this long
+const finishedOperationTTL = 10 * time.Minute
+
+// Operation - handle of running upload, download or repair
+type Operation struct {
+	mu           sync.Mutex
+	id           string
+	allocationID string
+	opType       string
+	localPath    string
+	remotePath   string
+	status       string
+	totalBytes   int64
+	doneBytes    int64
+	err          string
+	startedAt    time.Time
+	updatedAt    time.Time
+	cancelled    bool
+
+	next   StatusCallback
+	cancel func() error
+	pause  func() error
+	// run - sdk call of operation waiting for its cancel key
+	run func() error
+
+	// cancelKey - key sdk cancels the transfer by, operations sharing it run one by one
+	cancelKey string
+}
+
+// OperationSnapshot - progress snapshot of operation
+type OperationSnapshot struct {
+	ID             string `json:"id"`
+	AllocationID   string `json:"allocation_id"`
+	Type           string `json:"type"`
+	LocalPath      string `json:"local_path,omitempty"`
+	RemotePath     string `json:"remote_path,omitempty"`
+	Status         string `json:"status"`
+	TotalBytes     int64  `json:"total_bytes"`
+	CompletedBytes int64  `json:"completed_bytes"`
+	Error          string `json:"error,omitempty"`
+	StartedAt      int64  `json:"started_at"`
+	UpdatedAt      int64  `json:"updated_at"`
+}
+
+type operationRegistry struct {
+	mu  sync.Mutex
+	ops map[string]*Operation
+	// queues - operations sharing cancel key in start order, the first one holds the key
+	queues map[string][]*Operation
+}
+
+var operations = &operationRegistry{ops: make(map[string]*Operation), queues: make(map[string][]*Operation)}
+
+// paused returns paused holder of cancel key when it's the same transfer, so the transfer resumes with its handle
+func (r *operationRegistry) paused(cancelKey, opType, localPath, remotePath string) *Operation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	q := r.queues[cancelKey]
+	if len(q) == 0 || q[0].opType != opType || q[0].localPath != localPath || q[0].remotePath != remotePath {
+		return nil
+	}
+	if q[0].GetStatus() != OpStatusPaused {
+		return nil
+	}
+	return q[0]
+}
+
+// enqueue adds operation to queue of its cancel key, it returns true when the operation holds the key
+// and can run now, otherwise run is called once the key is released
+func (r *operationRegistry) enqueue(op *Operation, run func() error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	q := r.queues[op.cancelKey]
+	for _, o := range q {
+		if o == op {
+			return q[0] == op
+		}
+	}
+	r.queues[op.cancelKey] = append(q, op)
+	if len(q) == 0 {
+		return true
+	}
+	op.mu.Lock()
+	op.run = run
+	op.mu.Unlock()
+	return false
+}
+
+// holds reports whether operation holds its cancel key
+func (r *operationRegistry) holds(op *Operation) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	q := r.queues[op.cancelKey]
+	return len(q) > 0 && q[0] == op
+}
+
+// release removes finished operation from queue of its cancel key and starts the next one
+func (r *operationRegistry) release(op *Operation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	q := r.queues[op.cancelKey]
+	for i, o := range q {
+		if o != op {
+			continue
+		}
+		q = append(q[:i:i], q[i+1:]...)
+		if len(q) == 0 {
+			delete(r.queues, op.cancelKey)
+			return
+		}
+		r.queues[op.cancelKey] = q
+		if i == 0 {
+			go q[0].runQueued()
+		}
+		return
+	}
+}
+
+func newOperationID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// newOperation registers operation; its callback has to be passed to the sdk call
+func (a *Allocation) newOperation(opType, localPath, remotePath string, statusCb StatusCallback) *Operation {
+	now := time.Now()
+	op := &Operation{
+		id:           newOperationID(),
+		allocationID: a.ID,
+		opType:       opType,
+		localPath:    localPath,
+		remotePath:   remotePath,
+		status:       OpStatusPending,
+		startedAt:    now,
+		updatedAt:    now,
+		next:         statusCb,
+	}
+	operations.mu.Lock()
+	defer operations.mu.Unlock()
+	for id, o := range operations.ops {
+		if o.isFinished() && now.Sub(o.updated()) > finishedOperationTTL {
+			delete(operations.ops, id)
+		}
+	}
+	operations.ops[op.id] = op
+	return op
+}
+
+// start calls sdk when no other operation holds cancel key of the operation, otherwise the operation
+// is pending till the key is released and failure of the call is reported to its callback
+func (op *Operation) start(run func() error) (*Operation, error) {
+	if len(op.cancelKey) == 0 || operations.enqueue(op, run) {
+		return op.started(run())
+	}
+	return op, nil
+}
+
+// runQueued calls sdk for operation which waited for its cancel key
+func (op *Operation) runQueued() {
+	op.mu.Lock()
+	run := op.run
+	op.run = nil
+	op.mu.Unlock()
+	if run == nil {
+		return
+	}
+	if err := run(); err != nil {
+		op.Error(op.allocationID, op.remotePath, op.sdkOpCode(), err)
+	}
+}
+
+// sdkOpCode - sdk op code reported for operation type
+func (op *Operation) sdkOpCode() int {
+	switch op.opType {
+	case OpTypeDownload:
+		return sdk.OpDownload
+	case OpTypeRepair:
+		return sdk.OpRepair
+	default:
+		return sdk.OpUpload
+	}
+}
+
+// started returns operation or marks it failed when sdk call failed
+func (op *Operation) started(err error) (*Operation, error) {
+	if err != nil {
+		op.setStatus(OpStatusFailed, err)
+		return nil, err
+	}
+	return op, nil
+}
+
+func (op *Operation) setStatus(status string, err error) {
+	op.mu.Lock()
+	if op.cancelled && (status == OpStatusFailed || status == OpStatusCompleted) {
+		status = OpStatusCancelled
+	}
+	op.status = status
+	if err != nil {
+		op.err = err.Error()
+	}
+	op.updatedAt = time.Now()
+	op.mu.Unlock()
+	// paused operation keeps its key till it's resumed or cancelled
+	if status == OpStatusCompleted || status == OpStatusFailed || status == OpStatusCancelled {
+		operations.release(op)
+	}
+}
+
+func (op *Operation) isFinished() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.status == OpStatusCompleted || op.status == OpStatusFailed || op.status == OpStatusCancelled
+}
+
+func (op *Operation) isCancelled() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.cancelled
+}
+
+func (op *Operation) updated() time.Time {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.updatedAt
+}
+
+// GetID - unique operation ID
+func (op *Operation) GetID() string {
+	return op.id
+}
+
+// GetStatus - current status: pending, running, paused, completed, failed or cancelled
+func (op *Operation) GetStatus() string {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.status
+}
+
+// GetProgress - progress snapshot JSON
+func (op *Operation) GetProgress() (string, error) {
+	retBytes, err := json.Marshal(op.snapshot())
+	if err != nil {
+		return "", err
+	}
+	return string(retBytes), nil
+}
+
+func (op *Operation) snapshot() *OperationSnapshot {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return &OperationSnapshot{
+		ID:             op.id,
+		AllocationID:   op.allocationID,
+		Type:           op.opType,
+		LocalPath:      op.localPath,
+		RemotePath:     op.remotePath,
+		Status:         op.status,
+		TotalBytes:     op.totalBytes,
+		CompletedBytes: op.doneBytes,
+		Error:          op.err,
+		StartedAt:      op.startedAt.Unix(),
+		UpdatedAt:      op.updatedAt.Unix(),
+	}
+}
+
+// Cancel - cancel operation, progress is dropped. Operation waiting for other transfer of the same file
+// is dropped without touching the running one.
+func (op *Operation) Cancel() error {
+	if op.isFinished() {
+		return fmt.Errorf("operation %s is already finished", op.id)
+	}
+	if op.cancel == nil {
+		return fmt.Errorf("operation %s can't be cancelled", op.id)
+	}
+	op.mu.Lock()
+	op.cancelled = true
+	op.mu.Unlock()
+	if len(op.cancelKey) > 0 && !operations.holds(op) {
+		op.Error(op.allocationID, op.remotePath, op.sdkOpCode(), fmt.Errorf("operation %s cancelled", op.id))
+		return nil
+	}
+	if op.GetStatus() == OpStatusPaused {
+		// nothing runs in sdk, key is passed on
+		op.setStatus(OpStatusCancelled, nil)
+		return nil
+	}
+	return op.cancel()
+}
+
+// Pause - pause operation keeping its progress. Only chunked uploads (UploadFile, Put) and resumable downloads
+// can be paused, see PauseUpload and PauseDownload. Other transfers of the same file wait till the paused one
+// is resumed or cancelled.
+func (op *Operation) Pause() error {
+	if op.isFinished() {
+		return fmt.Errorf("operation %s is already finished", op.id)
+	}
+	if op.pause == nil {
+		return fmt.Errorf("operation %s can't be paused", op.id)
+	}
+	if len(op.cancelKey) > 0 && !operations.holds(op) {
+		return fmt.Errorf("operation %s is waiting for other transfer of the same file", op.id)
+	}
+	return op.pause()
+}
+
+// Started - operation started
+func (op *Operation) Started(allocationID, filePath string, opCode int, totalBytes int) {
+	op.mu.Lock()
+	op.status = OpStatusRunning
+	op.totalBytes = int64(totalBytes)
+	op.updatedAt = time.Now()
+	op.mu.Unlock()
+	if op.next != nil {
+		op.next.Started(allocationID, filePath, opCode, totalBytes)
+	}
+}
+
+// InProgress - operation in progress
+func (op *Operation) InProgress(allocationID, filePath string, opCode int, completedBytes int, data []byte) {
+	op.mu.Lock()
+	op.status = OpStatusRunning
+	op.doneBytes = int64(completedBytes)
+	op.updatedAt = time.Now()
+	op.mu.Unlock()
+	if op.next != nil {
+		op.next.InProgress(allocationID, filePath, opCode, completedBytes, data)
+	}
+}
+
+// Error - operation failed
+func (op *Operation) Error(allocationID string, filePath string, opCode int, err error) {
+	op.setStatus(OpStatusFailed, err)
+	if op.next != nil {
+		op.next.Error(allocationID, filePath, opCode, err)
+	}
+}
+
+// Completed - operation completed
+func (op *Operation) Completed(allocationID, filePath string, filename string, mimetype string, size int, opCode int) {
+	op.mu.Lock()
+	op.doneBytes = op.totalBytes
+	op.mu.Unlock()
+	op.setStatus(OpStatusCompleted, nil)
+	if op.next != nil {
+		op.next.Completed(allocationID, filePath, filename, mimetype, size, opCode)
+	}
+}
+
+// CommitMetaCompleted - commit meta completed
+func (op *Operation) CommitMetaCompleted(request, response string, err error) {
+	if op.next != nil {
+		op.next.CommitMetaCompleted(request, response, err)
+	}
+}
+
+// RepairCompleted - repair completed
+func (op *Operation) RepairCompleted(filesRepaired int) {
+	if op.opType == OpTypeRepair {
+		op.setStatus(OpStatusCompleted, nil)
+	}
+	if op.next != nil {
+		op.next.RepairCompleted(filesRepaired)
+	}
+}
+
+// Paused - operation paused, it holds its cancel key till it's resumed or cancelled
+func (op *Operation) Paused(allocationID, filePath string, opCode int) {
+	op.setStatus(OpStatusPaused, nil)
+	if next, ok := op.next.(PauseCallback); ok {
+		next.Paused(allocationID, filePath, opCode)
+	}
+	if cb := getPauseCallback(); cb != nil {
+		cb.Paused(allocationID, filePath, opCode)
+	}
+}
+
+// Resumed - operation resumed
+func (op *Operation) Resumed(allocationID, filePath string, opCode int) {
+	op.setStatus(OpStatusRunning, nil)
+	if next, ok := op.next.(PauseCallback); ok {
+		next.Resumed(allocationID, filePath, opCode)
+	}
+	if cb := getPauseCallback(); cb != nil {
+		cb.Resumed(allocationID, filePath, opCode)
+	}
+}
+
+// GetOperation - get operation handle by ID
+func (a *Allocation) GetOperation(id string) (*Operation, error) {
+	operations.mu.Lock()
+	defer operations.mu.Unlock()
+	op, ok := operations.ops[id]
+	if !ok || op.allocationID != a.ID {
+		return nil, fmt.Errorf("operation %s not found", id)
+	}
+	return op, nil
+}
+
+// ListOperations - list running and recently finished operations of the allocation
+func (a *Allocation) ListOperations() (string, error) {
+	operations.mu.Lock()
+	result := make([]*OperationSnapshot, 0, len(operations.ops))
+	for _, op := range operations.ops {
+		if op.allocationID == a.ID {
+			result = append(result, op.snapshot())
+		}
+	}
+	operations.mu.Unlock()
+	sort.Slice(result, func(i, j int) bool { return result[i].StartedAt < result[j].StartedAt })
+	retBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(retBytes), nil
+}
@@ -0,0 +1,108 @@
+package zbox
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testQueuedOperation starts operation with cancel key and reports its sdk call to started
+func testQueuedOperation(t *testing.T, a *Allocation, localPath, remotePath string, started chan<- string) *Operation {
+	cancel := func() error { return nil }
+	op := a.newCancellableOperation(OpTypeDownload, localPath, remotePath, "download:"+remotePath, cancel, nil)
+	if _, err := op.start(func() error {
+		started <- localPath
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return op
+}
+
+func expectStarted(t *testing.T, started <-chan string, localPath string) {
+	select {
+	case p := <-started:
+		if p != localPath {
+			t.Fatalf("expected %s to start, got %s", localPath, p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s didn't start", localPath)
+	}
+}
+
+func expectWaiting(t *testing.T, started <-chan string, op *Operation) {
+	select {
+	case p := <-started:
+		t.Fatalf("%s started while other transfer of the file runs", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if op.GetStatus() != OpStatusPending {
+		t.Fatalf("expected waiting operation to be pending, got %s", op.GetStatus())
+	}
+}
+
+func TestOperationsOfSameFileRunInOrder(t *testing.T) {
+	a := &Allocation{ID: "alloc"}
+	started := make(chan string, 10)
+
+	first := testQueuedOperation(t, a, "/tmp/a", "/a", started)
+	expectStarted(t, started, "/tmp/a")
+	second := testQueuedOperation(t, a, "/tmp/b", "/a", started)
+	third := testQueuedOperation(t, a, "/tmp/c", "/a", started)
+	expectWaiting(t, started, second)
+	if first.GetID() == second.GetID() {
+		t.Fatal("expected every transfer to get its own handle")
+	}
+	other := testQueuedOperation(t, a, "/tmp/d", "/d", started)
+	expectStarted(t, started, "/tmp/d")
+	other.Completed(a.ID, "/d", "d", "", 0, 1)
+
+	// waiting operation is cancelled by its ID without stopping the running one
+	if err := second.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	if second.GetStatus() != OpStatusCancelled || first.GetStatus() == OpStatusCancelled {
+		t.Fatalf("unexpected statuses %s and %s", first.GetStatus(), second.GetStatus())
+	}
+	expectWaiting(t, started, third)
+
+	first.Error(a.ID, "/a", 1, fmt.Errorf("failed"))
+	expectStarted(t, started, "/tmp/c")
+	third.Completed(a.ID, "/a", "a", "", 0, 1)
+	// finished operations leave no entries behind
+	testQueuedOperation(t, a, "/tmp/e", "/a", started).Completed(a.ID, "/a", "a", "", 0, 1)
+	expectStarted(t, started, "/tmp/e")
+	operations.mu.Lock()
+	queued := len(operations.queues[a.ID+":download:/a"])
+	operations.mu.Unlock()
+	if queued != 0 {
+		t.Fatalf("expected no queued operations, got %d", queued)
+	}
+}
+
+func TestPausedOperationKeepsKey(t *testing.T) {
+	a := &Allocation{ID: "alloc"}
+	started := make(chan string, 10)
+
+	first := testQueuedOperation(t, a, "/tmp/a", "/a", started)
+	expectStarted(t, started, "/tmp/a")
+	first.Paused(a.ID, "/a", 1)
+	waiting := testQueuedOperation(t, a, "/tmp/b", "/a", started)
+	expectWaiting(t, started, waiting)
+
+	// the same transfer started again resumes with its handle
+	resumed := testQueuedOperation(t, a, "/tmp/a", "/a", started)
+	expectStarted(t, started, "/tmp/a")
+	if resumed != first {
+		t.Fatal("expected paused operation to be resumed")
+	}
+	resumed.Resumed(a.ID, "/a", 1)
+	resumed.Paused(a.ID, "/a", 1)
+
+	// cancelled paused operation passes the key on
+	if err := first.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	expectStarted(t, started, "/tmp/b")
+	waiting.Completed(a.ID, "/a", "a", "", 0, 1)
+}
@@ -0,0 +1,137 @@
+package zbox
+
+import (
+	"fmt"
+	"sync"
+)
+
+// PauseCallback - receives pause and resume events of transfers, set by SetPauseCallback
+type PauseCallback interface {
+	// Paused - transfer is paused, its progress is kept
+	Paused(allocationID, filePath string, op int)
+	// Resumed - paused transfer is running again
+	Resumed(allocationID, filePath string, op int)
+}
+
+var (
+	pauseCallbackMu sync.Mutex
+	pauseCallback   PauseCallback
+)
+
+// SetPauseCallback - set callback notified when a transfer is paused or resumed. It's separate from
+// StatusCallback, so existing StatusCallback implementations keep working.
+func SetPauseCallback(cb PauseCallback) {
+	pauseCallbackMu.Lock()
+	defer pauseCallbackMu.Unlock()
+	pauseCallback = cb
+}
+
+func getPauseCallback() PauseCallback {
+	pauseCallbackMu.Lock()
+	defer pauseCallbackMu.Unlock()
+	return pauseCallback
+}
+
+// transferEntry - running transfer which can be paused
+type transferEntry struct {
+	allocationID string
+	localPath    string
+	remotePath   string
+	statusCb     StatusCallback
+	// pause marks transfer as paused, it's stopped by cancel afterwards
+	pause  func()
+	cancel func() error
+}
+
+// transferRegistry keeps running transfers by key and callbacks of paused ones
+type transferRegistry struct {
+	mu     sync.Mutex
+	active map[string]*transferEntry
+	paused map[string]StatusCallback
+}
+
+func newTransferRegistry() *transferRegistry {
+	return &transferRegistry{active: make(map[string]*transferEntry), paused: make(map[string]StatusCallback)}
+}
+
+var (
+	activeUploads   = newTransferRegistry()
+	activeDownloads = newTransferRegistry()
+)
+
+func (r *transferRegistry) add(key string, e *transferEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active[key] = e
+	delete(r.paused, key)
+}
+
+// remove removes transfer if it's still registered under the key
+func (r *transferRegistry) remove(key string, e *transferEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active[key] == e {
+		delete(r.active, key)
+	}
+}
+
+// pauseMatching pauses transfers matching filter and returns them
+func (r *transferRegistry) pauseMatching(match func(*transferEntry) bool) []*transferEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]*transferEntry, 0)
+	for key, e := range r.active {
+		if !match(e) {
+			continue
+		}
+		e.pause()
+		r.paused[key] = e.statusCb
+		result = append(result, e)
+	}
+	return result
+}
+
+// pausedCallback returns callback of paused transfer
+func (r *transferRegistry) pausedCallback(key string) StatusCallback {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cb := r.paused[key]
+	delete(r.paused, key)
+	return cb
+}
+
+// PauseUpload - pause chunked upload from localpath, RestartUpload uploads it again from the start.
+// Only uploads started by UploadFile, Put and RestartUpload can be paused; encrypted uploads, updates
+// and uploads with thumbnail started by other methods can only be cancelled.
+func (a *Allocation) PauseUpload(localPath string) error {
+	paused := activeUploads.pauseMatching(func(e *transferEntry) bool {
+		return e.allocationID == a.ID && e.localPath == localPath
+	})
+	if len(paused) == 0 {
+		return fmt.Errorf("no running upload of %s", localPath)
+	}
+	return cancelTransfers(paused)
+}
+
+// PauseDownload - pause resumable download of remote path keeping its progress, resume with ResumeDownload.
+// Only downloads started by DownloadFileResumable and DownloadFromAuthTicketResumable can be paused,
+// DownloadFile and other downloads can only be cancelled.
+func (a *Allocation) PauseDownload(remotePath string) error {
+	paused := activeDownloads.pauseMatching(func(e *transferEntry) bool {
+		return e.allocationID == a.ID && e.remotePath == remotePath
+	})
+	if len(paused) == 0 {
+		return fmt.Errorf("no running download of %s", remotePath)
+	}
+	return cancelTransfers(paused)
+}
+
+func cancelTransfers(entries []*transferEntry) error {
+	var err error
+	for _, e := range entries {
+		if cerr := e.cancel(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
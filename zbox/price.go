@@ -0,0 +1,149 @@
+package zbox
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/zcncore"
+)
+
+const (
+	defaultPriceCacheTTL = 5 * time.Minute
+	defaultPriceMaxStale = 1 * time.Hour
+)
+
+// PriceOracle - source of ZCN fiat prices, implemented by the host app.
+// GetPrice returns the price of one ZCN token in the given currency (e.g. "USD").
+type PriceOracle interface {
+	GetPrice(currency string) (float64, error)
+}
+
+// StaticPriceOracle - price oracle returning fixed prices, for tests and offline builds
+type StaticPriceOracle struct {
+	mu     sync.RWMutex
+	prices map[string]float64
+}
+
+// NewStaticPriceOracle - create empty static price oracle
+func NewStaticPriceOracle() *StaticPriceOracle {
+	return &StaticPriceOracle{prices: make(map[string]float64)}
+}
+
+// SetPrice - set price of one ZCN token in currency
+func (o *StaticPriceOracle) SetPrice(currency string, price float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.prices[strings.ToUpper(currency)] = price
+}
+
+// GetPrice - get price of one ZCN token in currency
+func (o *StaticPriceOracle) GetPrice(currency string) (float64, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	price, ok := o.prices[strings.ToUpper(currency)]
+	if !ok {
+		return 0, fmt.Errorf("no price for currency %s", currency)
+	}
+	return price, nil
+}
+
+type cachedPrice struct {
+	price     float64
+	fetchedAt time.Time
+}
+
+type priceCache struct {
+	mu       sync.Mutex
+	oracle   PriceOracle
+	ttl      time.Duration
+	maxStale time.Duration
+	prices   map[string]cachedPrice
+}
+
+var fiatPrices = &priceCache{
+	ttl:      defaultPriceCacheTTL,
+	maxStale: defaultPriceMaxStale,
+	prices:   make(map[string]cachedPrice),
+}
+
+// SetPriceOracle - set price oracle used for fiat conversion.
+// cacheTTLSeconds - how long a fetched price is used before asking the oracle again.
+// maxStaleSeconds - how long a cached price may still be used when the oracle fails.
+// Zero or negative values keep the defaults (5 minutes and 1 hour).
+func SetPriceOracle(oracle PriceOracle, cacheTTLSeconds, maxStaleSeconds int64) {
+	fiatPrices.mu.Lock()
+	defer fiatPrices.mu.Unlock()
+	fiatPrices.oracle = oracle
+	fiatPrices.ttl = defaultPriceCacheTTL
+	if cacheTTLSeconds > 0 {
+		fiatPrices.ttl = time.Duration(cacheTTLSeconds) * time.Second
+	}
+	fiatPrices.maxStale = defaultPriceMaxStale
+	if maxStaleSeconds > 0 {
+		fiatPrices.maxStale = time.Duration(maxStaleSeconds) * time.Second
+	}
+	if fiatPrices.maxStale < fiatPrices.ttl {
+		fiatPrices.maxStale = fiatPrices.ttl
+	}
+	fiatPrices.prices = make(map[string]cachedPrice)
+}
+
+func (c *priceCache) get(currency string) (float64, error) {
+	currency = strings.ToUpper(currency)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.oracle == nil {
+		return 0, fmt.Errorf("price oracle is not set")
+	}
+	cached, ok := c.prices[currency]
+	age := time.Since(cached.fetchedAt)
+	if ok && age < c.ttl {
+		return cached.price, nil
+	}
+	price, err := c.oracle.GetPrice(currency)
+	if err == nil && price <= 0 {
+		err = fmt.Errorf("invalid price %f", price)
+	}
+	if err != nil {
+		if ok && age < c.maxStale {
+			return cached.price, nil
+		}
+		return 0, fmt.Errorf("failed to get %s price. %v", currency, err)
+	}
+	c.prices[currency] = cachedPrice{price: price, fetchedAt: time.Now()}
+	return price, nil
+}
+
+// GetZcnPrice - get price of one ZCN token in currency from the price oracle
+func GetZcnPrice(currency string) (string, error) {
+	price, err := fiatPrices.get(currency)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%f", price), nil
+}
+
+// ConvertZcnTokenToFiat - converting Zcn tokens to fiat currency
+func ConvertZcnTokenToFiat(token float64, currency string) (string, error) {
+	price, err := fiatPrices.get(currency)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%f", token*price), nil
+}
+
+// ConvertZcnValueToFiat - converting Zcn value (as in pool balances) to fiat currency
+func ConvertZcnValueToFiat(value int64, currency string) (string, error) {
+	return ConvertZcnTokenToFiat(zcncore.ConvertToToken(value), currency)
+}
+
+// ConvertFiatToZcnToken - converting fiat amount to Zcn tokens
+func ConvertFiatToZcnToken(amount float64, currency string) (string, error) {
+	price, err := fiatPrices.get(currency)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%f", amount/price), nil
+}
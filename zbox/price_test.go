@@ -0,0 +1,101 @@
+package zbox
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type countingOracle struct {
+	price float64
+	err   error
+	calls int
+}
+
+func (o *countingOracle) GetPrice(currency string) (float64, error) {
+	o.calls++
+	return o.price, o.err
+}
+
+func newTestPriceCache(oracle PriceOracle, ttl, maxStale time.Duration) *priceCache {
+	return &priceCache{oracle: oracle, ttl: ttl, maxStale: maxStale, prices: make(map[string]cachedPrice)}
+}
+
+func TestPriceCacheTTL(t *testing.T) {
+	oracle := &countingOracle{price: 0.25}
+	c := newTestPriceCache(oracle, time.Minute, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		price, err := c.get("usd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if price != 0.25 {
+			t.Fatalf("expected price 0.25, got %f", price)
+		}
+	}
+	if oracle.calls != 1 {
+		t.Fatalf("expected 1 oracle call within TTL, got %d", oracle.calls)
+	}
+
+	// currency is case insensitive
+	if _, err := c.get("USD"); err != nil {
+		t.Fatal(err)
+	}
+	if oracle.calls != 1 {
+		t.Fatalf("expected cached price for USD, got %d oracle calls", oracle.calls)
+	}
+
+	// expired entry is fetched again
+	c.prices["USD"] = cachedPrice{price: 0.25, fetchedAt: time.Now().Add(-2 * time.Minute)}
+	oracle.price = 0.5
+	price, err := c.get("usd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != 0.5 || oracle.calls != 2 {
+		t.Fatalf("expected refreshed price 0.5 after TTL, got %f with %d calls", price, oracle.calls)
+	}
+}
+
+func TestPriceCacheStale(t *testing.T) {
+	oracle := &countingOracle{err: fmt.Errorf("offline")}
+	c := newTestPriceCache(oracle, time.Minute, time.Hour)
+
+	if _, err := c.get("usd"); err == nil {
+		t.Fatal("expected error without cached price")
+	}
+
+	// stale price is used while the oracle fails
+	c.prices["USD"] = cachedPrice{price: 0.25, fetchedAt: time.Now().Add(-10 * time.Minute)}
+	price, err := c.get("usd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != 0.25 {
+		t.Fatalf("expected stale price 0.25, got %f", price)
+	}
+
+	// too old price is not used
+	c.prices["USD"] = cachedPrice{price: 0.25, fetchedAt: time.Now().Add(-2 * time.Hour)}
+	if _, err = c.get("usd"); err == nil {
+		t.Fatal("expected error for price older than max stale")
+	}
+}
+
+func TestPriceCacheInvalidPrice(t *testing.T) {
+	c := newTestPriceCache(&countingOracle{price: 0}, time.Minute, time.Hour)
+	if _, err := c.get("usd"); err == nil {
+		t.Fatal("expected error for zero price")
+	}
+	if _, ok := c.prices["USD"]; ok {
+		t.Fatal("invalid price must not be cached")
+	}
+}
+
+func TestPriceCacheNoOracle(t *testing.T) {
+	c := newTestPriceCache(nil, time.Minute, time.Hour)
+	if _, err := c.get("usd"); err == nil {
+		t.Fatal("expected error without oracle")
+	}
+}
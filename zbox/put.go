@@ -0,0 +1,163 @@
+package zbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+)
+
+// Put modes
+const (
+	// PutModeCreate - upload new file, fails when remote file exists
+	PutModeCreate = "create"
+	// PutModeUpdate - replace existing remote file
+	PutModeUpdate = "update"
+	// PutModeOverwrite - update remote file when it exists, upload it otherwise
+	PutModeOverwrite = "overwrite"
+	// PutModeSkipUnchanged - like overwrite, but upload is skipped when remote file has the same content hash,
+	// it's reported by Started and Completed with OpUnchanged op code
+	PutModeSkipUnchanged = "skip_unchanged"
+)
+
+// PutOptions - options of Put
+type PutOptions struct {
+	// Workdir - work dir of chunked upload, SDK work dir by default
+	Workdir       string          `json:"workdir,omitempty"`
+	Encrypt       bool            `json:"encrypt,omitempty"`
+	ThumbnailPath string          `json:"thumbnail_path,omitempty"`
+	Attributes    json.RawMessage `json:"attributes,omitempty"`
+	// Mode - create (default), update, overwrite or skip_unchanged
+	Mode string `json:"mode,omitempty"`
+	// CommitMeta - commit meta transaction once upload is completed, reported by CommitMetaCompleted
+	CommitMeta bool `json:"commit_meta,omitempty"`
+	// ChunkSize - not supported, chunked upload of the sdk takes no chunk size and splits files by its own
+	// fixed size, so non-zero value is rejected instead of being silently ignored
+	ChunkSize int64 `json:"chunk_size,omitempty"`
+	// GenerateThumbnail - generate JPEG thumbnail of the image when thumbnail path isn't set
+	GenerateThumbnail *ThumbnailOptions `json:"generate_thumbnail,omitempty"`
+	// Compression - codec compressing the file before encryption and upload, e.g. gzip. Codec is recorded
+	// in hidden /.compression dir, owner's downloads, range reads and streams decompress the file.
+	Compression string `json:"compression,omitempty"`
+}
+
+func parsePutOptions(options string) (*PutOptions, error) {
+	opts := &PutOptions{}
+	if len(options) > 0 {
+		if err := json.Unmarshal([]byte(options), opts); err != nil {
+			return nil, fmt.Errorf("invalid put options JSON. %v", err)
+		}
+	}
+	if opts.ChunkSize != 0 {
+		return nil, fmt.Errorf("chunk_size is not supported by sdk chunked upload")
+	}
+	if len(opts.Workdir) == 0 {
+		opts.Workdir = workDir
+	}
+	if len(opts.Workdir) == 0 {
+		opts.Workdir = os.TempDir()
+	}
+	return opts, nil
+}
+
+// Put - start chunked upload of localpath to remote path. options is PutOptions JSON and
+// covers encryption, thumbnail, attributes, create/update mode and commit behaviour in any combination,
+// chunk size can't be set.
+func (a *Allocation) Put(localPath, remotePath, options string, statusCb StatusCallback) (*Operation, error) {
+	opts, err := parsePutOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Compression) > 0 {
+		return a.putCompressed(localPath, remotePath, opts, statusCb)
+	}
+	var attrs fileref.Attributes
+	var fileAttrs string
+	if len(opts.Attributes) > 0 && string(opts.Attributes) != "null" {
+		fileAttrs = string(opts.Attributes)
+		err = json.Unmarshal(opts.Attributes, &attrs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert fileAttrs. %v", err)
+		}
+	}
+	var isUpdate bool
+	switch opts.Mode {
+	case "", PutModeCreate:
+	case PutModeUpdate:
+		isUpdate = true
+	case PutModeOverwrite:
+		fileMeta, err := a.remoteFileMeta(remotePath)
+		if err != nil {
+			return nil, err
+		}
+		isUpdate = fileMeta != nil
+	case PutModeSkipUnchanged:
+		fileMeta, unchanged, err := a.remoteUnchanged(localPath, remotePath)
+		if err != nil {
+			return nil, err
+		}
+		if unchanged {
+			return a.skipUnchanged(localPath, remotePath, fileMeta, statusCb), nil
+		}
+		isUpdate = fileMeta != nil
+	default:
+		return nil, fmt.Errorf("unknown put mode %s", opts.Mode)
+	}
+
+	next := statusCb
+	// waiters aren't notified when upload fails to start right away
+	var waiters []*statusWaiter
+	if opts.GenerateThumbnail != nil && len(opts.ThumbnailPath) == 0 {
+		var dir string
+		opts.ThumbnailPath, dir, err = newThumbnail(localPath, opts.GenerateThumbnail)
+		if err != nil {
+			return nil, err
+		}
+		w := newStatusWaiter(next)
+		go func() {
+			// thumbnail is generated again when paused upload is restarted
+			w.wait()
+			os.RemoveAll(dir)
+		}()
+		waiters = append(waiters, w)
+		next = w
+	}
+	if opts.CommitMeta {
+		w := newStatusWaiter(next)
+		go a.commitMetaAfter(w, remotePath, isUpdate, statusCb)
+		waiters = append(waiters, w)
+		next = w
+	}
+	op := a.newUploadOperation(localPath, remotePath, next)
+	op, err = op.start(func() error {
+		tracker, err := a.trackUpload(opts.Workdir, localPath, remotePath, fileAttrs, options, op, statusCb)
+		if err != nil {
+			return err
+		}
+		if isUpdate {
+			tracker = a.versionedUpdate(localPath, remotePath, tracker)
+		}
+		return a.sdkAllocation.StartChunkedUpload(opts.Workdir, localPath, remotePath, tracker, isUpdate, opts.ThumbnailPath, opts.Encrypt, attrs)
+	})
+	if err != nil {
+		for _, w := range waiters {
+			w.finish(err)
+		}
+	}
+	return op, err
+}
+
+// commitMetaAfter commits meta transaction once upload is completed
+func (a *Allocation) commitMetaAfter(w *statusWaiter, remotePath string, isUpdate bool, statusCb StatusCallback) {
+	if err := w.wait(); err != nil {
+		return
+	}
+	crudOperation := "Upload"
+	if isUpdate {
+		crudOperation = "Update"
+	}
+	if err := a.sdkAllocation.CommitMetaTransaction(remotePath, crudOperation, "", "", nil, statusCb); err != nil {
+		statusCb.CommitMetaCompleted("", "", err)
+	}
+}
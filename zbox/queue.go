@@ -0,0 +1,530 @@
+package zbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+const (
+	queueFile = "transfer_queue.json"
+
+	defaultQueueConcurrency = 2
+	defaultQueueMaxRetries  = 3
+	queueRetryBaseDelay     = 5 * time.Second
+	queueRetryMaxDelay      = 10 * time.Minute
+)
+
+// Queue job statuses
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusFailed    = "failed"
+	JobStatusCompleted = "completed"
+)
+
+// QueueListener - listener of transfer queue changes, called from one goroutine in the order of changes
+type QueueListener interface {
+	// OnQueueChanged - job was added, updated or removed; job is QueueJob JSON, empty when removed
+	OnQueueChanged(jobID string, status string, job string)
+}
+
+// QueueJobOptions - options of queued transfer
+type QueueJobOptions struct {
+	Workdir       string          `json:"workdir,omitempty"`
+	Attributes    json.RawMessage `json:"attributes,omitempty"`
+	Encrypt       bool            `json:"encrypt,omitempty"`
+	ThumbnailPath string          `json:"thumbnail_path,omitempty"`
+	MaxRetries    int             `json:"max_retries,omitempty"`
+	// Network - network constraint, any or unmetered
+	Network string `json:"network,omitempty"`
+	// GenerateThumbnail - generate JPEG thumbnail of the image when thumbnail path isn't set
+	GenerateThumbnail *ThumbnailOptions `json:"generate_thumbnail,omitempty"`
+	// SkipUnchanged - skip upload when remote file has the same content hash, update it otherwise
+	SkipUnchanged bool `json:"skip_unchanged,omitempty"`
+}
+
+// QueueJob - persisted transfer job
+type QueueJob struct {
+	ID            string           `json:"id"`
+	AllocationID  string           `json:"allocation_id"`
+	Type          string           `json:"type"`
+	LocalPath     string           `json:"local_path"`
+	RemotePath    string           `json:"remote_path"`
+	Options       *QueueJobOptions `json:"options"`
+	Priority      int              `json:"priority"`
+	Status        string           `json:"status"`
+	Attempts      int              `json:"attempts"`
+	NextAttemptAt int64            `json:"next_attempt_at,omitempty"`
+	OperationID   string           `json:"operation_id,omitempty"`
+	Error         string           `json:"error,omitempty"`
+	CreatedAt     int64            `json:"created_at"`
+	UpdatedAt     int64            `json:"updated_at"`
+}
+
+type transferQueue struct {
+	s           *StorageSDK
+	mu          sync.Mutex
+	jobs        map[string]*QueueJob
+	ops         map[string]*Operation
+	allocations map[string]*Allocation
+	listener    QueueListener
+	concurrency int
+	running     int
+	started     bool
+	// loopDone - closed when the last started run loop exits
+	loopDone chan struct{}
+	wake     chan struct{}
+	// events - listener notifications not delivered yet, delivering is set while a goroutine delivers them
+	events     []*queueEvent
+	delivering bool
+}
+
+// queueEvent - notification of listener about job change
+type queueEvent struct {
+	listener QueueListener
+	jobID    string
+	status   string
+	job      string
+}
+
+func newTransferQueue(s *StorageSDK) *transferQueue {
+	return &transferQueue{
+		s:           s,
+		jobs:        make(map[string]*QueueJob),
+		ops:         make(map[string]*Operation),
+		allocations: make(map[string]*Allocation),
+		concurrency: defaultQueueConcurrency,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// load restores jobs from work dir, interrupted jobs are queued again.
+// Corrupt queue file is moved aside and the queue starts empty.
+func (q *transferQueue) load() error {
+	if len(workDir) == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(workDir, queueFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var jobs []*QueueJob
+	if err = json.Unmarshal(data, &jobs); err != nil {
+		path := filepath.Join(workDir, queueFile)
+		corruptPath := fmt.Sprintf("%s.corrupt-%d", path, time.Now().Unix())
+		l.Logger.Error("failed to load transfer queue, it's moved to ", corruptPath, ": ", err)
+		if err = os.Rename(path, corruptPath); err != nil {
+			l.Logger.Error("failed to move transfer queue: ", err)
+		}
+		return nil
+	}
+	for _, job := range jobs {
+		if job.Status == JobStatusRunning {
+			job.Status = JobStatusQueued
+			job.OperationID = ""
+		}
+		q.jobs[job.ID] = job
+	}
+	return nil
+}
+
+// save persists jobs, caller holds q.mu
+func (q *transferQueue) save() {
+	if len(workDir) == 0 {
+		return
+	}
+	jobs := make([]*QueueJob, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, job)
+	}
+	data, err := json.Marshal(jobs)
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(workDir, queueFile), data)
+	}
+	if err != nil {
+		l.Logger.Error("failed to save transfer queue: ", err)
+	}
+}
+
+// changed persists queue and notifies listener, caller holds q.mu
+func (q *transferQueue) changed(job *QueueJob, removed bool) {
+	job.UpdatedAt = time.Now().Unix()
+	q.save()
+	if q.listener == nil {
+		return
+	}
+	jobJSON := ""
+	if !removed {
+		if data, err := json.Marshal(job); err == nil {
+			jobJSON = string(data)
+		}
+	}
+	q.events = append(q.events, &queueEvent{listener: q.listener, jobID: job.ID, status: job.Status, job: jobJSON})
+	if !q.delivering {
+		q.delivering = true
+		go q.deliverEvents()
+	}
+}
+
+// deliverEvents notifies listener of queued events in order, it exits when there are no more events
+func (q *transferQueue) deliverEvents() {
+	for {
+		q.mu.Lock()
+		if len(q.events) == 0 {
+			q.delivering = false
+			q.mu.Unlock()
+			return
+		}
+		e := q.events[0]
+		q.events[0] = nil
+		q.events = q.events[1:]
+		q.mu.Unlock()
+		e.listener.OnQueueChanged(e.jobID, e.status, e.job)
+	}
+}
+
+func (q *transferQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *transferQueue) enqueue(job *QueueJob) string {
+	now := time.Now()
+	job.ID = newOperationID()
+	job.Status = JobStatusQueued
+	job.CreatedAt = now.Unix()
+	if job.Options.MaxRetries == 0 {
+		job.Options.MaxRetries = defaultQueueMaxRetries
+	}
+	q.mu.Lock()
+	q.jobs[job.ID] = job
+	q.changed(job, false)
+	q.mu.Unlock()
+	q.notify()
+	return job.ID
+}
+
+func (q *transferQueue) run(done chan struct{}) {
+	defer close(done)
+	for {
+		q.mu.Lock()
+		if !q.started {
+			q.mu.Unlock()
+			return
+		}
+		wait := q.dispatch()
+		q.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-q.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// dispatch starts ready jobs by priority and returns time until the next retry, caller holds q.mu
+func (q *transferQueue) dispatch() time.Duration {
+	now := time.Now().Unix()
+	wait := time.Minute
+	state := currentNetworkState()
+	ready := make([]*QueueJob, 0)
+	for _, job := range q.jobs {
+		if job.Status != JobStatusQueued || !networkAllowed(job.Options.Network, state) {
+			continue
+		}
+		if job.NextAttemptAt > now {
+			if d := time.Duration(job.NextAttemptAt-now) * time.Second; d < wait {
+				wait = d
+			}
+			continue
+		}
+		ready = append(ready, job)
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		if ready[i].Priority != ready[j].Priority {
+			return ready[i].Priority > ready[j].Priority
+		}
+		return ready[i].CreatedAt < ready[j].CreatedAt
+	})
+	for _, job := range ready {
+		if q.running >= q.concurrency {
+			break
+		}
+		q.running++
+		job.Status = JobStatusRunning
+		job.Attempts++
+		job.Error = ""
+		q.changed(job, false)
+		go q.execute(job)
+	}
+	return wait
+}
+
+func (q *transferQueue) execute(job *QueueJob) {
+	err := q.transfer(job)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running--
+	delete(q.ops, job.ID)
+	if _, ok := q.jobs[job.ID]; !ok {
+		// removed while running
+		q.notify()
+		return
+	}
+	switch {
+	case err == nil:
+		job.Status = JobStatusCompleted
+	case err == errTransferPaused || !networkAllowed(job.Options.Network, currentNetworkState()):
+		// stopped by network policy, it's not counted as attempt
+		job.Status = JobStatusQueued
+		job.Attempts--
+	case job.Attempts > job.Options.MaxRetries:
+		job.Status = JobStatusFailed
+		job.Error = err.Error()
+	default:
+		job.Status = JobStatusQueued
+		job.Error = err.Error()
+		delay := queueRetryBaseDelay << uint(job.Attempts-1)
+		if delay > queueRetryMaxDelay || delay <= 0 {
+			delay = queueRetryMaxDelay
+		}
+		job.NextAttemptAt = time.Now().Add(delay).Unix()
+	}
+	q.changed(job, false)
+	q.notify()
+}
+
+func (q *transferQueue) transfer(job *QueueJob) error {
+	a, err := q.allocation(job.AllocationID)
+	if err != nil {
+		return err
+	}
+	w := newStatusWaiter(nil)
+	var op *Operation
+	if job.Type == OpTypeDownload {
+		op, err = a.DownloadFileResumable(job.RemotePath, job.LocalPath, w)
+	} else {
+		spec := &UploadSpec{
+			LocalPath:         job.LocalPath,
+			RemotePath:        job.RemotePath,
+			Attributes:        job.Options.Attributes,
+			Encrypt:           job.Options.Encrypt,
+			ThumbnailPath:     job.Options.ThumbnailPath,
+			GenerateThumbnail: job.Options.GenerateThumbnail,
+			SkipUnchanged:     job.Options.SkipUnchanged,
+		}
+		op, err = a.uploadSpec(job.Options.Workdir, spec, w)
+	}
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	q.ops[job.ID] = op
+	job.OperationID = op.GetID()
+	q.changed(job, false)
+	q.mu.Unlock()
+	return w.wait()
+}
+
+// networkChanged pauses running jobs violating network constraint, they're queued again
+func (q *transferQueue) networkChanged(state string) {
+	q.mu.Lock()
+	toStop := make([]*Operation, 0)
+	for id, op := range q.ops {
+		if job, ok := q.jobs[id]; ok && !networkAllowed(job.Options.Network, state) {
+			toStop = append(toStop, op)
+		}
+	}
+	q.mu.Unlock()
+	for _, op := range toStop {
+		if err := op.Pause(); err != nil {
+			op.Cancel()
+		}
+	}
+	q.notify()
+}
+
+func (q *transferQueue) allocation(allocationID string) (*Allocation, error) {
+	q.mu.Lock()
+	a, ok := q.allocations[allocationID]
+	q.mu.Unlock()
+	if ok {
+		return a, nil
+	}
+	a, err := q.s.GetAllocation(allocationID)
+	if err != nil {
+		return nil, err
+	}
+	q.mu.Lock()
+	q.allocations[allocationID] = a
+	q.mu.Unlock()
+	return a, nil
+}
+
+func parseQueueJobOptions(options string) (*QueueJobOptions, error) {
+	opts := &QueueJobOptions{}
+	if len(options) > 0 {
+		if err := json.Unmarshal([]byte(options), opts); err != nil {
+			return nil, fmt.Errorf("invalid queue job options JSON. %v", err)
+		}
+	}
+	return opts, nil
+}
+
+// SetQueueListener - set listener of transfer queue changes
+func (s *StorageSDK) SetQueueListener(listener QueueListener) {
+	s.queue.mu.Lock()
+	defer s.queue.mu.Unlock()
+	s.queue.listener = listener
+}
+
+// SetQueueConcurrency - set number of transfers running at once
+func (s *StorageSDK) SetQueueConcurrency(concurrency int) error {
+	if concurrency <= 0 {
+		return fmt.Errorf("invalid concurrency %d", concurrency)
+	}
+	s.queue.mu.Lock()
+	s.queue.concurrency = concurrency
+	s.queue.mu.Unlock()
+	s.queue.notify()
+	return nil
+}
+
+// StartQueue - start running queued transfers, restored jobs wait until it's called
+func (s *StorageSDK) StartQueue() {
+	s.queue.mu.Lock()
+	if s.queue.started {
+		s.queue.mu.Unlock()
+		return
+	}
+	prev := s.queue.loopDone
+	s.queue.mu.Unlock()
+	if prev != nil {
+		// loop stopped by StopQueue may still be waiting for wake up
+		<-prev
+	}
+	s.queue.mu.Lock()
+	defer s.queue.mu.Unlock()
+	if s.queue.started {
+		return
+	}
+	s.queue.started = true
+	s.queue.loopDone = make(chan struct{})
+	go s.queue.run(s.queue.loopDone)
+}
+
+// StopQueue - stop starting new transfers, running ones are finished
+func (s *StorageSDK) StopQueue() {
+	s.queue.mu.Lock()
+	s.queue.started = false
+	s.queue.mu.Unlock()
+	s.queue.notify()
+}
+
+// EnqueueUpload - add upload to transfer queue, higher priority runs first. Returns job ID.
+// options is QueueJobOptions JSON.
+func (s *StorageSDK) EnqueueUpload(allocationID, localPath, remotePath, options string, priority int) (string, error) {
+	opts, err := parseQueueJobOptions(options)
+	if err != nil {
+		return "", err
+	}
+	if _, err = os.Stat(localPath); err != nil {
+		return "", err
+	}
+	job := &QueueJob{AllocationID: allocationID, Type: OpTypeUpload, LocalPath: localPath, RemotePath: remotePath, Options: opts, Priority: priority}
+	return s.queue.enqueue(job), nil
+}
+
+// EnqueueDownload - add download to transfer queue, higher priority runs first. Returns job ID.
+// options is QueueJobOptions JSON.
+func (s *StorageSDK) EnqueueDownload(allocationID, remotePath, localPath, options string, priority int) (string, error) {
+	opts, err := parseQueueJobOptions(options)
+	if err != nil {
+		return "", err
+	}
+	job := &QueueJob{AllocationID: allocationID, Type: OpTypeDownload, LocalPath: localPath, RemotePath: remotePath, Options: opts, Priority: priority}
+	return s.queue.enqueue(job), nil
+}
+
+// GetQueueJobs - list jobs of transfer queue
+func (s *StorageSDK) GetQueueJobs() (string, error) {
+	s.queue.mu.Lock()
+	jobs := make([]*QueueJob, 0, len(s.queue.jobs))
+	for _, job := range s.queue.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt < jobs[j].CreatedAt })
+	retBytes, err := json.Marshal(jobs)
+	s.queue.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	return string(retBytes), nil
+}
+
+// RetryQueueJob - queue failed job again
+func (s *StorageSDK) RetryQueueJob(jobID string) error {
+	s.queue.mu.Lock()
+	job, ok := s.queue.jobs[jobID]
+	if !ok {
+		s.queue.mu.Unlock()
+		return fmt.Errorf("job %s not found", jobID)
+	}
+	if job.Status != JobStatusFailed {
+		s.queue.mu.Unlock()
+		return fmt.Errorf("job %s is %s", jobID, job.Status)
+	}
+	job.Status = JobStatusQueued
+	job.Attempts = 0
+	job.NextAttemptAt = 0
+	s.queue.changed(job, false)
+	s.queue.mu.Unlock()
+	s.queue.notify()
+	return nil
+}
+
+// RemoveQueueJob - remove job from transfer queue, running transfer is cancelled
+func (s *StorageSDK) RemoveQueueJob(jobID string) error {
+	s.queue.mu.Lock()
+	job, ok := s.queue.jobs[jobID]
+	if !ok {
+		s.queue.mu.Unlock()
+		return fmt.Errorf("job %s not found", jobID)
+	}
+	delete(s.queue.jobs, jobID)
+	op := s.queue.ops[jobID]
+	s.queue.changed(job, true)
+	s.queue.mu.Unlock()
+	if op != nil {
+		return op.Cancel()
+	}
+	return nil
+}
+
+// ClearFinishedQueueJobs - remove completed and failed jobs from transfer queue
+func (s *StorageSDK) ClearFinishedQueueJobs() {
+	s.queue.mu.Lock()
+	defer s.queue.mu.Unlock()
+	for id, job := range s.queue.jobs {
+		if job.Status == JobStatusCompleted || job.Status == JobStatusFailed {
+			delete(s.queue.jobs, id)
+			s.queue.changed(job, true)
+		}
+	}
+}
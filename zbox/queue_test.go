@@ -0,0 +1,110 @@
+package zbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueLoadCorruptFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	prev := workDir
+	workDir = dir
+	defer func() { workDir = prev }()
+
+	if err = ioutil.WriteFile(filepath.Join(dir, queueFile), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	q := newTransferQueue(&StorageSDK{})
+	if err = q.load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.jobs) != 0 {
+		t.Fatalf("expected empty queue, got %d jobs", len(q.jobs))
+	}
+	if _, err = os.Stat(filepath.Join(dir, queueFile)); !os.IsNotExist(err) {
+		t.Fatal("corrupt queue file was not moved aside")
+	}
+	moved, _ := filepath.Glob(filepath.Join(dir, queueFile+".corrupt-*"))
+	if len(moved) != 1 {
+		t.Fatalf("expected moved queue file, got %v", moved)
+	}
+}
+
+func TestQueueRestartWaitsForStoppedLoop(t *testing.T) {
+	s := &StorageSDK{}
+	s.queue = newTransferQueue(s)
+
+	s.StartQueue()
+	first := s.queue.loopDone
+	s.StopQueue()
+	s.StartQueue()
+	select {
+	case <-first:
+	default:
+		t.Fatal("stopped run loop is still running")
+	}
+	s.StartQueue()
+	s.queue.mu.Lock()
+	second := s.queue.loopDone
+	s.queue.mu.Unlock()
+	s.StopQueue()
+	<-second
+}
+
+// testQueueListener records statuses of job changes and blocks on the first one
+type testQueueListener struct {
+	mu       sync.Mutex
+	statuses []string
+	release  chan struct{}
+}
+
+func (l *testQueueListener) OnQueueChanged(jobID string, status string, job string) {
+	l.mu.Lock()
+	first := len(l.statuses) == 0
+	l.statuses = append(l.statuses, status)
+	l.mu.Unlock()
+	if first {
+		<-l.release
+	}
+}
+
+func TestQueueEventsAreDeliveredInOrder(t *testing.T) {
+	q := newTransferQueue(&StorageSDK{})
+	listener := &testQueueListener{release: make(chan struct{})}
+	q.listener = listener
+
+	job := &QueueJob{ID: "job"}
+	expected := []string{JobStatusQueued, JobStatusRunning, JobStatusFailed, JobStatusQueued, JobStatusRunning, JobStatusCompleted}
+	q.mu.Lock()
+	for _, status := range expected {
+		job.Status = status
+		q.changed(job, false)
+	}
+	q.mu.Unlock()
+	// later events wait for the listener
+	close(listener.release)
+
+	for i := 0; i < 100; i++ {
+		q.mu.Lock()
+		delivering := q.delivering
+		q.mu.Unlock()
+		if !delivering {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	if strings.Join(listener.statuses, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected events %v, got %v", expected, listener.statuses)
+	}
+}
@@ -0,0 +1,202 @@
+package zbox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+// encryption header stored with every encrypted chunk
+const encryptedChunkOverhead = 16 + 2*1024
+
+// blocks downloaded and written at once by range reads, bounds memory used by a read
+const rangeBatchBlocks = downloadBlocksPerRequest
+
+// blockDownloader downloads blocks from startBlock to endBlock inclusive into localPath
+type blockDownloader func(localPath string, startBlock, endBlock int64, statusCb StatusCallback) error
+
+// writerAdapter adapts host Writer to io.Writer
+type writerAdapter struct {
+	w Writer
+}
+
+func (a *writerAdapter) Write(p []byte) (int, error) {
+	if err := a.w.Write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// blockContentSize - bytes of file content kept in one block across data shards
+func blockContentSize(dataShards int, encrypted bool) int64 {
+	chunkSize := int64(fileref.CHUNK_SIZE)
+	if encrypted {
+		chunkSize -= encryptedChunkOverhead
+	}
+	return chunkSize * int64(dataShards)
+}
+
+// ReadRange - read length bytes of remote file from offset, range past the end of file is trimmed.
+// Range of compressed file is a range of its decompressed content.
+func (a *Allocation) ReadRange(remotePath string, offset, length int64) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := a.readRemoteRange(remotePath, offset, length, buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReadRangeToWriter - stream length bytes of remote file from offset into host writer
+func (a *Allocation) ReadRangeToWriter(remotePath string, offset, length int64, writer Writer) error {
+	if writer == nil {
+		return fmt.Errorf("writer is required")
+	}
+	return a.readRemoteRange(remotePath, offset, length, &writerAdapter{w: writer})
+}
+
+// ReadRangeFromAuthTicket - read length bytes of shared file from offset, range past the end of file is trimmed.
+// Shared compressed file is read as stored.
+func (a *Allocation) ReadRangeFromAuthTicket(authTicket, remoteLookupHash, remoteFilename string, rxPay bool, offset, length int64) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := a.readSharedRange(authTicket, remoteLookupHash, remoteFilename, rxPay, offset, length, buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReadRangeFromAuthTicketToWriter - stream length bytes of shared file from offset into host writer
+func (a *Allocation) ReadRangeFromAuthTicketToWriter(authTicket, remoteLookupHash, remoteFilename string, rxPay bool, offset, length int64, writer Writer) error {
+	if writer == nil {
+		return fmt.Errorf("writer is required")
+	}
+	return a.readSharedRange(authTicket, remoteLookupHash, remoteFilename, rxPay, offset, length, &writerAdapter{w: writer})
+}
+
+// fileBlockDownloader downloads blocks of remote file
+func (a *Allocation) fileBlockDownloader(remotePath string) blockDownloader {
+	return func(localPath string, startBlock, endBlock int64, cb StatusCallback) error {
+		return a.sdkAllocation.DownloadFileByBlock(localPath, remotePath, startBlock, endBlock, downloadBlocksPerRequest, cb)
+	}
+}
+
+// sharedBlockDownloader downloads blocks of file shared by auth ticket
+func (a *Allocation) sharedBlockDownloader(authTicket, remoteLookupHash, remoteFilename string, rxPay bool) blockDownloader {
+	return func(localPath string, startBlock, endBlock int64, cb StatusCallback) error {
+		return a.sdkAllocation.DownloadFromAuthTicketByBlocks(localPath, authTicket, startBlock, endBlock, downloadBlocksPerRequest, remoteLookupHash, remoteFilename, rxPay, cb)
+	}
+}
+
+func (a *Allocation) readRemoteRange(remotePath string, offset, length int64, w io.Writer) error {
+	fileMeta, err := a.sdkAllocation.GetFileMeta(remotePath)
+	if err != nil {
+		return err
+	}
+	r, err := a.compressionRecord(fileMeta.Hash)
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		return a.readPlainRange(fileMeta, r, offset, length, w)
+	}
+	return a.readRange(fileMeta, offset, length, w, a.fileBlockDownloader(remotePath))
+}
+
+// readPlainRange decompresses compressed file from its start up to the end of the range
+func (a *Allocation) readPlainRange(fileMeta *sdk.ConsolidatedFileMeta, r *compressionRecord, offset, length int64, w io.Writer) error {
+	if offset < 0 || length < 0 {
+		return fmt.Errorf("invalid range offset %d length %d", offset, length)
+	}
+	if offset >= r.Size || length == 0 {
+		return nil
+	}
+	if offset+length > r.Size {
+		length = r.Size - offset
+	}
+	f := &streamFile{
+		token:     newOperationID(),
+		meta:      fileMeta,
+		blockSize: blockContentSize(a.DataShards, len(fileMeta.EncryptedKey) > 0),
+		download:  a.fileBlockDownloader(fileMeta.Path),
+	}
+	plain := newPlainReader(nil, f, r)
+	defer plain.Close()
+	if _, err := plain.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.CopyN(w, plain, length)
+	return err
+}
+
+func (a *Allocation) readSharedRange(authTicket, remoteLookupHash, remoteFilename string, rxPay bool, offset, length int64, w io.Writer) error {
+	fileMeta, err := a.sdkAllocation.GetFileMetaFromAuthTicket(authTicket, remoteLookupHash)
+	if err != nil {
+		return err
+	}
+	return a.readRange(fileMeta, offset, length, w, a.sharedBlockDownloader(authTicket, remoteLookupHash, remoteFilename, rxPay))
+}
+
+// readRange downloads blocks covering the byte range in batches and writes exactly the requested bytes
+func (a *Allocation) readRange(fileMeta *sdk.ConsolidatedFileMeta, offset, length int64, w io.Writer, download blockDownloader) error {
+	if offset < 0 || length < 0 {
+		return fmt.Errorf("invalid range offset %d length %d", offset, length)
+	}
+	if offset >= fileMeta.Size || length == 0 {
+		return nil
+	}
+	if offset+length > fileMeta.Size {
+		length = fileMeta.Size - offset
+	}
+	blockSize := blockContentSize(a.DataShards, len(fileMeta.EncryptedKey) > 0)
+	startBlock := offset/blockSize + 1
+	endBlock := (offset+length-1)/blockSize + 1
+	// start - offset of the range in the first batch
+	start := offset - (startBlock-1)*blockSize
+	for batch := startBlock; batch <= endBlock; batch += rangeBatchBlocks {
+		last := batch + rangeBatchBlocks - 1
+		if last > endBlock {
+			last = endBlock
+		}
+		data, err := downloadBlocks(fileMeta.Name, batch, last, download)
+		if err != nil {
+			return err
+		}
+		n := (last-batch+1)*blockSize - start
+		if n > length {
+			n = length
+		}
+		if start+n > int64(len(data)) {
+			return fmt.Errorf("downloaded %d bytes of blocks %d-%d, expected at least %d", len(data), batch, last, start+n)
+		}
+		if _, err = w.Write(data[start : start+n]); err != nil {
+			return err
+		}
+		length -= n
+		start = 0
+	}
+	return nil
+}
+
+// downloadBlocks downloads blocks from startBlock to endBlock inclusive into memory
+func downloadBlocks(name string, startBlock, endBlock int64, download blockDownloader) ([]byte, error) {
+	dir, err := newSpoolDir("range")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	localPath := filepath.Join(dir, name)
+	waiter := newStatusWaiter(nil)
+	err = download(localPath, startBlock, endBlock, waiter)
+	if err == nil {
+		err = waiter.wait()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(localPath)
+}
@@ -0,0 +1,60 @@
+package zbox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+func TestReadRangeDownloadsBoundedBatches(t *testing.T) {
+	a := &Allocation{ID: "alloc", DataShards: 2}
+	blockSize := blockContentSize(a.DataShards, false)
+	content := make([]byte, 25*blockSize+100)
+	for i := range content {
+		content[i] = byte(i * 13)
+	}
+	var batches [][2]int64
+	download := func(localPath string, startBlock, endBlock int64, cb StatusCallback) error {
+		batches = append(batches, [2]int64{startBlock, endBlock})
+		end := endBlock * blockSize
+		if end > int64(len(content)) {
+			end = int64(len(content))
+		}
+		if err := ioutil.WriteFile(localPath, content[(startBlock-1)*blockSize:end], 0600); err != nil {
+			return err
+		}
+		go cb.Completed(a.ID, "/file", "file", "", int(end-(startBlock-1)*blockSize), sdk.OpDownload)
+		return nil
+	}
+	fileMeta := &sdk.ConsolidatedFileMeta{Name: "file", Path: "/file", Size: int64(len(content))}
+
+	offset, length := blockSize+5, 22*blockSize
+	buf := &bytes.Buffer{}
+	if err := a.readRange(fileMeta, offset, length, buf, download); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), content[offset:offset+length]) {
+		t.Fatal("range content doesn't match")
+	}
+	expected := [][2]int64{{2, 11}, {12, 21}, {22, 24}}
+	if len(batches) != len(expected) {
+		t.Fatalf("expected batches %v, got %v", expected, batches)
+	}
+	for i := range expected {
+		if batches[i] != expected[i] {
+			t.Fatalf("expected batches %v, got %v", expected, batches)
+		}
+	}
+
+	// range past the end of file is trimmed
+	buf.Reset()
+	batches = nil
+	if err := a.readRange(fileMeta, int64(len(content))-10, 100, buf, download); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), content[len(content)-10:]) || len(batches) != 1 {
+		t.Fatalf("expected last 10 bytes in one batch, got %d bytes in %d", buf.Len(), len(batches))
+	}
+}
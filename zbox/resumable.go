@@ -0,0 +1,260 @@
+package zbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/core/encryption"
+	l "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+// workDir - SDK work dir from config, keeps state which has to survive app restarts
+var workDir string
+
+const (
+	uploadsDir = "uploads"
+
+	// minimal interval between progress saves
+	progressSaveInterval = time.Second
+)
+
+// Interrupted upload statuses
+const (
+	UploadStatusInProgress = "in_progress"
+	UploadStatusPaused     = "paused"
+	UploadStatusFailed     = "failed"
+)
+
+// InterruptedUpload - persisted state of chunked upload which failed, was paused or killed with the app.
+// Sdk reports only uploaded bytes, not its chunk index or blobber commit state, so the upload can't be
+// resumed from the last committed chunk and RestartUpload uploads the file from the start.
+type InterruptedUpload struct {
+	ID           string `json:"id"`
+	AllocationID string `json:"allocation_id"`
+	Workdir      string `json:"workdir"`
+	LocalPath    string `json:"local_path"`
+	RemotePath   string `json:"remote_path"`
+	Attributes   string `json:"attributes,omitempty"`
+	Options      string `json:"options,omitempty"`
+	Size         int64  `json:"size"`
+	ModTime      int64  `json:"mod_time"`
+	// UploadedBytes - bytes uploaded before the upload was interrupted
+	UploadedBytes int64  `json:"uploaded_bytes"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	UpdatedAt     int64  `json:"updated_at"`
+}
+
+// uploadTracker persists progress of chunked upload and forwards events to status callback
+type uploadTracker struct {
+	*statusWaiter
+	mu       sync.Mutex
+	upload   *InterruptedUpload
+	lastSave time.Time
+	paused   bool
+	// done - upload is committed and its state removed
+	done  bool
+	entry *transferEntry
+}
+
+func uploadID(allocationID, localPath, remotePath string) string {
+	return encryption.Hash(allocationID + ":" + localPath + ":" + remotePath)[:32]
+}
+
+func interruptedUploadPath(id string) string {
+	return filepath.Join(workDir, uploadsDir, id+".json")
+}
+
+// trackUpload starts persisting of upload state and makes op pausable; op is returned as is without work dir.
+// Paused upload is restarted with callback of the caller, not of op.
+func (a *Allocation) trackUpload(workdir, localPath, remotePath, fileAttrs, options string, op *Operation, callerCb StatusCallback) (StatusCallback, error) {
+	if len(workDir) == 0 {
+		return op, nil
+	}
+	fi, err := os.Stat(localPath)
+	if err != nil {
+		return nil, err
+	}
+	id := uploadID(a.ID, localPath, remotePath)
+	upload := &InterruptedUpload{
+		ID:           id,
+		AllocationID: a.ID,
+		Workdir:      workdir,
+		LocalPath:    localPath,
+		RemotePath:   remotePath,
+		Attributes:   fileAttrs,
+		Options:      options,
+		Size:         fi.Size(),
+		ModTime:      fi.ModTime().Unix(),
+		Status:       UploadStatusInProgress,
+	}
+	t := &uploadTracker{
+		statusWaiter: newStatusWaiter(op),
+		upload:       upload,
+	}
+	t.onProgress = t.progress
+	t.save(true)
+	t.entry = &transferEntry{
+		allocationID: a.ID,
+		localPath:    localPath,
+		remotePath:   remotePath,
+		statusCb:     callerCb,
+		pause:        t.pause,
+		cancel:       op.cancel,
+	}
+	op.pause = func() error {
+		t.pause()
+		return t.entry.cancel()
+	}
+	activeUploads.add(id, t.entry)
+	return t, nil
+}
+
+func (t *uploadTracker) progress(completedBytes int) {
+	t.mu.Lock()
+	t.upload.UploadedBytes = int64(completedBytes)
+	t.mu.Unlock()
+	t.save(false)
+}
+
+// Error - upload failed or paused, state is kept for restart
+func (t *uploadTracker) Error(allocationID string, filePath string, op int, err error) {
+	activeUploads.remove(t.upload.ID, t.entry)
+	t.mu.Lock()
+	paused := t.paused
+	if paused {
+		t.upload.Status = UploadStatusPaused
+	} else {
+		t.upload.Status = UploadStatusFailed
+		t.upload.Error = err.Error()
+	}
+	t.mu.Unlock()
+	t.save(true)
+	if paused {
+		t.statusWaiter.Paused(allocationID, filePath, op)
+		return
+	}
+	t.statusWaiter.Error(allocationID, filePath, op, err)
+}
+
+func (t *uploadTracker) pause() {
+	t.mu.Lock()
+	t.paused = true
+	t.mu.Unlock()
+}
+
+// Completed - upload is committed to blobbers, state is removed
+func (t *uploadTracker) Completed(allocationID, filePath string, filename string, mimetype string, size int, op int) {
+	activeUploads.remove(t.upload.ID, t.entry)
+	t.mu.Lock()
+	t.done = true
+	t.mu.Unlock()
+	if err := os.Remove(interruptedUploadPath(t.upload.ID)); err != nil && !os.IsNotExist(err) {
+		l.Logger.Error("failed to remove upload state: ", err)
+	}
+	t.statusWaiter.Completed(allocationID, filePath, filename, mimetype, size, op)
+}
+
+func (t *uploadTracker) save(force bool) {
+	t.mu.Lock()
+	if t.done || (!force && time.Since(t.lastSave) < progressSaveInterval) {
+		t.mu.Unlock()
+		return
+	}
+	t.lastSave = time.Now()
+	t.upload.UpdatedAt = t.lastSave.Unix()
+	data, err := json.Marshal(t.upload)
+	t.mu.Unlock()
+	if err == nil {
+		err = writeFileAtomic(interruptedUploadPath(t.upload.ID), data)
+	}
+	if err != nil {
+		l.Logger.Error("failed to save upload state: ", err)
+	}
+}
+
+func loadInterruptedUpload(id string) (*InterruptedUpload, error) {
+	data, err := ioutil.ReadFile(interruptedUploadPath(id))
+	if err != nil {
+		return nil, err
+	}
+	upload := &InterruptedUpload{}
+	if err = json.Unmarshal(data, upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// ListInterruptedUploads - list interrupted uploads of the allocation which can be restarted
+func (a *Allocation) ListInterruptedUploads() (string, error) {
+	if len(workDir) == 0 {
+		return "", fmt.Errorf("work_dir is not set in config")
+	}
+	files, err := ioutil.ReadDir(filepath.Join(workDir, uploadsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	result := make([]*InterruptedUpload, 0)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		upload, err := loadInterruptedUpload(strings.TrimSuffix(f.Name(), ".json"))
+		if err != nil {
+			l.Logger.Error("failed to load upload state ", f.Name(), ": ", err)
+			continue
+		}
+		if upload.AllocationID == a.ID {
+			result = append(result, upload)
+		}
+	}
+	retBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(retBytes), nil
+}
+
+// RestartUpload - upload interrupted or paused upload by ID from the start with its original options.
+// statusCb may be nil for paused upload to keep its original callback.
+func (a *Allocation) RestartUpload(id string, statusCb StatusCallback) (*Operation, error) {
+	if len(workDir) == 0 {
+		return nil, fmt.Errorf("work_dir is not set in config")
+	}
+	upload, err := loadInterruptedUpload(id)
+	if err != nil {
+		return nil, fmt.Errorf("no interrupted upload %s. %v", id, err)
+	}
+	if upload.AllocationID != a.ID {
+		return nil, fmt.Errorf("upload %s belongs to allocation %s", id, upload.AllocationID)
+	}
+	fi, err := os.Stat(upload.LocalPath)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() != upload.Size || fi.ModTime().Unix() != upload.ModTime {
+		return nil, fmt.Errorf("local file %s changed since upload started", upload.LocalPath)
+	}
+	if statusCb == nil {
+		if statusCb = activeUploads.pausedCallback(id); statusCb == nil {
+			return nil, fmt.Errorf("status callback is required")
+		}
+	}
+	var op *Operation
+	if len(upload.Options) > 0 {
+		op, err = a.Put(upload.LocalPath, upload.RemotePath, upload.Options, statusCb)
+	} else {
+		op, err = a.UploadFile(upload.Workdir, upload.LocalPath, upload.RemotePath, upload.Attributes, statusCb)
+	}
+	if err == nil && upload.Status == UploadStatusPaused {
+		op.Resumed(a.ID, upload.RemotePath, sdk.OpUpload)
+	}
+	return op, err
+}
@@ -0,0 +1,383 @@
+package zbox
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	l "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+const (
+	// blocks downloaded and persisted at once
+	downloadSegmentBlocks = 100
+	// blocks requested from blobbers in one request
+	downloadBlocksPerRequest = 10
+
+	downloadStateSuffix   = ".zdownload"
+	downloadPartialSuffix = ".partial"
+	downloadSegmentSuffix = ".segment"
+)
+
+// resumableDownload - download progress persisted next to the partial local file
+type resumableDownload struct {
+	AllocationID    string `json:"allocation_id"`
+	RemotePath      string `json:"remote_path"`
+	LocalPath       string `json:"local_path"`
+	AuthTicket      string `json:"auth_ticket,omitempty"`
+	LookupHash      string `json:"lookup_hash,omitempty"`
+	RemoteFilename  string `json:"remote_filename,omitempty"`
+	RxPay           bool   `json:"rx_pay,omitempty"`
+	MimeType        string `json:"mimetype"`
+	ContentHash     string `json:"content_hash"`
+	Size            int64  `json:"size"`
+	NumBlocks       int64  `json:"num_blocks"`
+	CompletedBlocks int64  `json:"completed_blocks"`
+	PartialSize     int64  `json:"partial_size"`
+	Paused          bool   `json:"paused,omitempty"`
+	// Segments - segments appended to the partial file, checked on resume
+	Segments []downloadSegment `json:"segments,omitempty"`
+
+	paused int32
+}
+
+// downloadSegment - blocks appended to the partial file at once
+type downloadSegment struct {
+	EndBlock int64  `json:"end_block"`
+	Size     int64  `json:"size"`
+	Hash     string `json:"hash"`
+}
+
+// DownloadFileResumable - start download file from remote path to localpath which can be resumed
+// with ResumeDownload after restart or network failure
+func (a *Allocation) DownloadFileResumable(remotePath, localPath string, statusCb StatusCallback) (*Operation, error) {
+	if d, err := loadResumableDownload(localPath); err == nil && d.RemotePath == remotePath {
+		return a.ResumeDownload(localPath, statusCb)
+	}
+	fileMeta, err := a.sdkAllocation.GetFileMeta(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	d := &resumableDownload{RemotePath: remotePath, RemoteFilename: fileMeta.Name}
+	return a.startResumableDownload(d, fileMeta, localPath, statusCb)
+}
+
+// DownloadFromAuthTicketResumable - start download shared file to localpath which can be resumed
+// with ResumeDownload after restart or network failure
+func (a *Allocation) DownloadFromAuthTicketResumable(localPath string, authTicket string, remoteLookupHash string, remoteFilename string, rxPay bool, statusCb StatusCallback) (*Operation, error) {
+	if d, err := loadResumableDownload(localPath); err == nil && d.LookupHash == remoteLookupHash {
+		return a.ResumeDownload(localPath, statusCb)
+	}
+	fileMeta, err := a.sdkAllocation.GetFileMetaFromAuthTicket(authTicket, remoteLookupHash)
+	if err != nil {
+		return nil, err
+	}
+	d := &resumableDownload{
+		RemotePath:     fileMeta.Path,
+		AuthTicket:     authTicket,
+		LookupHash:     remoteLookupHash,
+		RemoteFilename: remoteFilename,
+		RxPay:          rxPay,
+	}
+	return a.startResumableDownload(d, fileMeta, localPath, statusCb)
+}
+
+// ResumeDownload - resume interrupted or paused download into localPath from the last verified segment of blocks.
+// statusCb may be nil for paused download to keep its original callback.
+func (a *Allocation) ResumeDownload(localPath string, statusCb StatusCallback) (*Operation, error) {
+	d, err := loadResumableDownload(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("no resumable download for %s. %v", localPath, err)
+	}
+	if d.AllocationID != a.ID {
+		return nil, fmt.Errorf("download %s belongs to allocation %s", localPath, d.AllocationID)
+	}
+	if statusCb == nil {
+		if statusCb = activeDownloads.pausedCallback(d.key()); statusCb == nil {
+			return nil, fmt.Errorf("status callback is required")
+		}
+	}
+	// partial file is touched only once running download of the same file is finished
+	op := a.newResumableDownloadOperation(d, statusCb)
+	return op.start(func() error {
+		if err := d.reload(); err != nil {
+			return err
+		}
+		if err := d.verifySegments(); err != nil {
+			return err
+		}
+		if d.Paused {
+			d.Paused = false
+			op.Resumed(a.ID, d.RemotePath, sdk.OpDownload)
+		}
+		go a.runResumableDownload(d, op, statusCb)
+		return nil
+	})
+}
+
+func (a *Allocation) startResumableDownload(d *resumableDownload, fileMeta *sdk.ConsolidatedFileMeta, localPath string, statusCb StatusCallback) (*Operation, error) {
+	if fi, err := os.Stat(localPath); err == nil && fi.IsDir() {
+		localPath = filepath.Join(localPath, fileMeta.Name)
+	}
+	d.AllocationID = a.ID
+	d.LocalPath = localPath
+	d.MimeType = fileMeta.MimeType
+	d.ContentHash = fileMeta.Hash
+	d.Size = fileMeta.Size
+	d.NumBlocks = fileMeta.ActualNumBlocks
+	op := a.newResumableDownloadOperation(d, statusCb)
+	return op.start(func() error {
+		if _, err := os.Stat(localPath); err == nil {
+			return fmt.Errorf("local file already exists '%s'", localPath)
+		}
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return err
+		}
+		err := ioutil.WriteFile(localPath+downloadPartialSuffix, nil, 0644)
+		if err == nil {
+			err = d.save()
+		}
+		if err != nil {
+			return err
+		}
+		go a.runResumableDownload(d, op, statusCb)
+		return nil
+	})
+}
+
+func (a *Allocation) newResumableDownloadOperation(d *resumableDownload, statusCb StatusCallback) *Operation {
+	// sdk tracks auth ticket downloads by lookup hash
+	key := d.RemotePath
+	if len(d.AuthTicket) > 0 {
+		key = d.LookupHash
+	}
+	op := a.newCancellableOperation(OpTypeDownload, d.LocalPath, d.RemotePath, "download:"+key, func() error {
+		return a.sdkAllocation.CancelDownload(key)
+	}, statusCb)
+	op.pause = func() error {
+		atomic.StoreInt32(&d.paused, 1)
+		return op.cancel()
+	}
+	return op
+}
+
+// runResumableDownload reports events to op, paused download is resumed with callback of the caller
+func (a *Allocation) runResumableDownload(d *resumableDownload, op *Operation, callerCb StatusCallback) {
+	entry := &transferEntry{
+		allocationID: a.ID,
+		localPath:    d.LocalPath,
+		remotePath:   d.RemotePath,
+		statusCb:     callerCb,
+		pause: func() {
+			atomic.StoreInt32(&d.paused, 1)
+		},
+		cancel: op.cancel,
+	}
+	activeDownloads.add(d.key(), entry)
+	defer activeDownloads.remove(d.key(), entry)
+
+	op.Started(a.ID, d.RemotePath, sdk.OpDownload, int(d.Size))
+	partialPath := d.LocalPath + downloadPartialSuffix
+	segmentPath := d.LocalPath + downloadSegmentSuffix
+	for start := d.CompletedBlocks + 1; start <= d.NumBlocks; start += downloadSegmentBlocks {
+		if d.isPaused(op) {
+			return
+		}
+		end := start + downloadSegmentBlocks - 1
+		if end > d.NumBlocks {
+			end = d.NumBlocks
+		}
+		os.Remove(segmentPath)
+		w := newStatusWaiter(nil)
+		w.onProgress = func(completedBytes int) {
+			op.InProgress(a.ID, d.RemotePath, sdk.OpDownload, int(d.PartialSize)+completedBytes, nil)
+		}
+		var err error
+		if len(d.AuthTicket) > 0 {
+			err = a.sdkAllocation.DownloadFromAuthTicketByBlocks(segmentPath, d.AuthTicket, start, end, downloadBlocksPerRequest, d.LookupHash, d.RemoteFilename, d.RxPay, w)
+		} else {
+			err = a.sdkAllocation.DownloadFileByBlock(segmentPath, d.RemotePath, start, end, downloadBlocksPerRequest, w)
+		}
+		if err == nil {
+			err = w.wait()
+		}
+		if d.isPaused(op) {
+			return
+		}
+		if err == nil {
+			err = d.appendSegment(segmentPath, end)
+		}
+		if err != nil {
+			op.Error(a.ID, d.RemotePath, sdk.OpDownload, err)
+			return
+		}
+		op.InProgress(a.ID, d.RemotePath, sdk.OpDownload, int(d.PartialSize), nil)
+	}
+	os.Remove(segmentPath)
+
+	if len(d.ContentHash) > 0 {
+		err := verifyFile(partialPath, d.ContentHash)
+		if e, ok := err.(*IntegrityError); ok {
+			// sdk doesn't check content hash of downloads by blocks
+			if mode := downloadVerification(); mode == VerifyQuarantine {
+				discardCorrupted(e, mode)
+			}
+			d.remove()
+		}
+		if err != nil {
+			op.Error(a.ID, d.RemotePath, sdk.OpDownload, err)
+			return
+		}
+	}
+	size, mimetype, err := a.decompressDownload(d, partialPath)
+	if err == nil {
+		err = os.Rename(partialPath, d.LocalPath)
+	}
+	if err != nil {
+		op.Error(a.ID, d.RemotePath, sdk.OpDownload, err)
+		return
+	}
+	os.Remove(d.LocalPath + downloadStateSuffix)
+	op.Completed(a.ID, d.RemotePath, filepath.Base(d.LocalPath), mimetype, int(size), sdk.OpDownload)
+}
+
+// decompressDownload decompresses assembled file when its content is recorded as compressed.
+// Records of the owner can't be read with auth ticket, shared file is kept as stored.
+func (a *Allocation) decompressDownload(d *resumableDownload, partialPath string) (int64, string, error) {
+	if len(d.AuthTicket) > 0 {
+		return d.Size, d.MimeType, nil
+	}
+	r, err := a.compressionRecord(d.ContentHash)
+	if err != nil || r == nil {
+		return d.Size, d.MimeType, err
+	}
+	if err = decompressFile(partialPath, r); err != nil {
+		// verified partial file is kept, resume decompresses it again
+		return 0, "", err
+	}
+	return r.Size, fileMimeType(partialPath), nil
+}
+
+// appendSegment moves downloaded blocks to the partial file and persists progress with segment hash.
+// Padding of the last block is dropped.
+func (d *resumableDownload) appendSegment(segmentPath string, endBlock int64) error {
+	seg, err := os.Open(segmentPath)
+	if err != nil {
+		return err
+	}
+	defer seg.Close()
+	partial, err := os.OpenFile(d.LocalPath+downloadPartialSuffix, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	h := sha1.New()
+	n, err := io.Copy(io.MultiWriter(partial, h), io.LimitReader(seg, d.Size-d.PartialSize))
+	if err == nil {
+		err = partial.Sync()
+	}
+	if cerr := partial.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	d.Segments = append(d.Segments, downloadSegment{EndBlock: endBlock, Size: n, Hash: hex.EncodeToString(h.Sum(nil))})
+	d.CompletedBlocks = endBlock
+	d.PartialSize += n
+	return d.save()
+}
+
+// verifySegments truncates the partial file after the last segment matching its saved hash,
+// dropping data which was not persisted or got corrupted before interruption
+func (d *resumableDownload) verifySegments() error {
+	partialPath := d.LocalPath + downloadPartialSuffix
+	f, err := os.Open(partialPath)
+	if os.IsNotExist(err) {
+		d.Segments, d.CompletedBlocks, d.PartialSize = nil, 0, 0
+		return ioutil.WriteFile(partialPath, nil, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	var size, completed int64
+	for i, seg := range d.Segments {
+		h := sha1.New()
+		n, err := io.Copy(h, io.LimitReader(f, seg.Size))
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if n != seg.Size || hex.EncodeToString(h.Sum(nil)) != seg.Hash {
+			l.Logger.Info("download ", d.LocalPath, " resumes after block ", completed, ", segment ending at block ", seg.EndBlock, " doesn't match")
+			d.Segments = d.Segments[:i]
+			break
+		}
+		size += seg.Size
+		completed = seg.EndBlock
+	}
+	f.Close()
+	d.CompletedBlocks, d.PartialSize = completed, size
+	return os.Truncate(partialPath, size)
+}
+
+// reload reads state saved by other download of the same file
+func (d *resumableDownload) reload() error {
+	saved, err := loadResumableDownload(d.LocalPath)
+	if err != nil {
+		return fmt.Errorf("no resumable download for %s. %v", d.LocalPath, err)
+	}
+	*d = *saved
+	return nil
+}
+
+func (d *resumableDownload) key() string {
+	return d.AllocationID + ":" + d.LocalPath
+}
+
+// isPaused reports pause to status callback and persists it
+func (d *resumableDownload) isPaused(op *Operation) bool {
+	if atomic.LoadInt32(&d.paused) == 0 {
+		return false
+	}
+	d.Paused = true
+	if err := d.save(); err != nil {
+		l.Logger.Error("failed to save download state: ", err)
+	}
+	op.Paused(d.AllocationID, d.RemotePath, sdk.OpDownload)
+	return true
+}
+
+func (d *resumableDownload) save() error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(d.LocalPath+downloadStateSuffix, data)
+}
+
+func (d *resumableDownload) remove() {
+	for _, suffix := range []string{downloadPartialSuffix, downloadSegmentSuffix, downloadStateSuffix} {
+		if err := os.Remove(d.LocalPath + suffix); err != nil && !os.IsNotExist(err) {
+			l.Logger.Error("failed to remove ", d.LocalPath+suffix, ": ", err)
+		}
+	}
+}
+
+func loadResumableDownload(localPath string) (*resumableDownload, error) {
+	data, err := ioutil.ReadFile(localPath + downloadStateSuffix)
+	if err != nil {
+		return nil, err
+	}
+	d := &resumableDownload{}
+	if err = json.Unmarshal(data, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
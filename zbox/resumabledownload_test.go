@@ -0,0 +1,101 @@
+package zbox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestDownload(t *testing.T, size int64) (*resumableDownload, string, func()) {
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &resumableDownload{LocalPath: filepath.Join(dir, "file"), Size: size}
+	if err = ioutil.WriteFile(d.LocalPath+downloadPartialSuffix, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return d, dir, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func appendTestSegment(t *testing.T, d *resumableDownload, dir string, data []byte, endBlock int64) {
+	segmentPath := filepath.Join(dir, "segment")
+	if err := ioutil.WriteFile(segmentPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.appendSegment(segmentPath, endBlock); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendSegmentTrimsPadding(t *testing.T) {
+	d, dir, cleanup := newTestDownload(t, 10)
+	defer cleanup()
+
+	appendTestSegment(t, d, dir, []byte("0123"), 1)
+	// last block is padded to block size
+	appendTestSegment(t, d, dir, []byte("456789\x00\x00"), 2)
+
+	data, err := ioutil.ReadFile(d.LocalPath + downloadPartialSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "0123456789" {
+		t.Fatalf("unexpected partial content %q", data)
+	}
+	if d.PartialSize != 10 || d.CompletedBlocks != 2 || len(d.Segments) != 2 {
+		t.Fatalf("unexpected progress %d bytes, %d blocks, %d segments", d.PartialSize, d.CompletedBlocks, len(d.Segments))
+	}
+	if err = verifyFile(d.LocalPath+downloadPartialSuffix, "87acec17cd9dcd20a716cc2cf67417b71c8a7016"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifySegmentsDropsCorruptedTail(t *testing.T) {
+	d, dir, cleanup := newTestDownload(t, 12)
+	defer cleanup()
+
+	appendTestSegment(t, d, dir, []byte("aaaa"), 1)
+	appendTestSegment(t, d, dir, []byte("bbbb"), 2)
+	appendTestSegment(t, d, dir, []byte("cccc"), 3)
+
+	partialPath := d.LocalPath + downloadPartialSuffix
+	if err := ioutil.WriteFile(partialPath, []byte("aaaabbxbcccc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := loadResumableDownload(d.LocalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = resumed.verifySegments(); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.CompletedBlocks != 1 || resumed.PartialSize != 4 || len(resumed.Segments) != 1 {
+		t.Fatalf("expected resume after block 1, got %d blocks, %d bytes", resumed.CompletedBlocks, resumed.PartialSize)
+	}
+	data, err := ioutil.ReadFile(partialPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("aaaa")) {
+		t.Fatalf("unexpected partial content %q", data)
+	}
+}
+
+func TestVerifySegmentsMissingPartial(t *testing.T) {
+	d, dir, cleanup := newTestDownload(t, 4)
+	defer cleanup()
+
+	appendTestSegment(t, d, dir, []byte("aaaa"), 1)
+	os.Remove(d.LocalPath + downloadPartialSuffix)
+	if err := d.verifySegments(); err != nil {
+		t.Fatal(err)
+	}
+	if d.CompletedBlocks != 0 || d.PartialSize != 0 || len(d.Segments) != 0 {
+		t.Fatal("expected download to start over")
+	}
+}
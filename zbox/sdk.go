@@ -21,12 +21,16 @@ type ChainConfig struct {
 	PreferredBlobbers []string `json:"preferred_blobbers"`
 	BlockWorker       string   `json:"block_worker"`
 	SignatureScheme   string   `json:"signature_scheme"`
+	EthNode           string   `json:"eth_node,omitempty"`
+	WorkDir           string   `json:"work_dir,omitempty"`
 }
 
 // StorageSDK - storage SDK config
 type StorageSDK struct {
 	chainconfig *ChainConfig
 	client      *client.Client
+	bridge      *bridge
+	queue       *transferQueue
 }
 
 // SetLogFile - setting up log level for core libraries
@@ -50,7 +54,10 @@ func InitStorageSDK(clientjson string, configjson string) (*StorageSDK, error) {
 		l.Logger.Error(err)
 		return nil, err
 	}
-	err = zcncore.InitZCNSDK(configObj.BlockWorker, configObj.SignatureScheme)
+	err = zcncore.InitZCNSDK(configObj.BlockWorker, configObj.SignatureScheme, func(c *zcncore.ChainConfig) error {
+		c.EthNode = configObj.EthNode
+		return nil
+	})
 	if err != nil {
 		l.Logger.Error(err)
 		return nil, err
@@ -60,8 +67,17 @@ func InitStorageSDK(clientjson string, configjson string) (*StorageSDK, error) {
 		l.Logger.Error(err)
 		return nil, err
 	}
+	workDir = configObj.WorkDir
+	cleanSpool()
+	storageSdk := &StorageSDK{client: client.GetClient(), chainconfig: configObj}
+	storageSdk.queue = newTransferQueue(storageSdk)
+	err = storageSdk.queue.load()
+	if err != nil {
+		l.Logger.Error(err)
+		return nil, err
+	}
 	l.Logger.Info("Init successful")
-	return &StorageSDK{client: client.GetClient(), chainconfig: configObj}, nil
+	return storageSdk, nil
 }
 
 // CreateAllocation - creating new allocation
@@ -0,0 +1,39 @@
+package zbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+const spoolDir = "spool"
+
+// newSpoolDir creates private temp dir in work dir, system temp dir is used without work dir
+func newSpoolDir(prefix string) (string, error) {
+	base := workDir
+	if len(base) == 0 {
+		base = os.TempDir()
+	}
+	if err := os.MkdirAll(filepath.Join(base, spoolDir), 0700); err != nil {
+		return "", err
+	}
+	return ioutil.TempDir(filepath.Join(base, spoolDir), prefix)
+}
+
+var cleanSpoolOnce sync.Once
+
+// cleanSpool removes copies left by transfers of previous process, it runs once per process
+// so copies of running transfers aren't removed when sdk is initialized again
+func cleanSpool() {
+	cleanSpoolOnce.Do(func() {
+		if len(workDir) == 0 {
+			return
+		}
+		if err := os.RemoveAll(filepath.Join(workDir, spoolDir)); err != nil {
+			l.Logger.Error("failed to clean spool dir: ", err)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package zbox
+
+import (
+	"errors"
+	"sync"
+)
+
+// errTransferPaused - transfer is stopped by pause, not by failure
+var errTransferPaused = errors.New("transfer paused")
+
+// statusWaiter is a StatusCallback which lets caller wait for the end of async file operation.
+// Events are forwarded to next callback if it's set.
+type statusWaiter struct {
+	next       StatusCallback
+	onStarted  func(totalBytes int)
+	onProgress func(completedBytes int)
+	onPaused   func()
+	// onCompleted receives op code of completion, OpUnchanged for skipped upload
+	onCompleted func(op int)
+
+	once sync.Once
+	done chan error
+}
+
+func newStatusWaiter(next StatusCallback) *statusWaiter {
+	return &statusWaiter{next: next, done: make(chan error, 1)}
+}
+
+func (w *statusWaiter) finish(err error) {
+	w.once.Do(func() {
+		w.done <- err
+	})
+}
+
+// wait blocks until operation is completed or failed
+func (w *statusWaiter) wait() error {
+	return <-w.done
+}
+
+// Started - operation started
+func (w *statusWaiter) Started(allocationID, filePath string, op int, totalBytes int) {
+	if w.onStarted != nil {
+		w.onStarted(totalBytes)
+	}
+	if w.next != nil {
+		w.next.Started(allocationID, filePath, op, totalBytes)
+	}
+}
+
+// InProgress - operation in progress
+func (w *statusWaiter) InProgress(allocationID, filePath string, op int, completedBytes int, data []byte) {
+	if w.onProgress != nil {
+		w.onProgress(completedBytes)
+	}
+	if w.next != nil {
+		w.next.InProgress(allocationID, filePath, op, completedBytes, data)
+	}
+}
+
+// Error - operation failed
+func (w *statusWaiter) Error(allocationID string, filePath string, op int, err error) {
+	if w.next != nil {
+		w.next.Error(allocationID, filePath, op, err)
+	}
+	w.finish(err)
+}
+
+// Completed - operation completed
+func (w *statusWaiter) Completed(allocationID, filePath string, filename string, mimetype string, size int, op int) {
+	if w.onCompleted != nil {
+		w.onCompleted(op)
+	}
+	if w.next != nil {
+		w.next.Completed(allocationID, filePath, filename, mimetype, size, op)
+	}
+	w.finish(nil)
+}
+
+// CommitMetaCompleted - commit meta completed
+func (w *statusWaiter) CommitMetaCompleted(request, response string, err error) {
+	if w.next != nil {
+		w.next.CommitMetaCompleted(request, response, err)
+	}
+}
+
+// RepairCompleted - repair completed
+func (w *statusWaiter) RepairCompleted(filesRepaired int) {
+	if w.next != nil {
+		w.next.RepairCompleted(filesRepaired)
+	}
+}
+
+// Paused - transfer paused
+func (w *statusWaiter) Paused(allocationID, filePath string, op int) {
+	if next, ok := w.next.(PauseCallback); ok {
+		next.Paused(allocationID, filePath, op)
+	}
+	if w.onPaused != nil {
+		w.onPaused()
+	}
+	w.finish(errTransferPaused)
+}
+
+// Resumed - transfer resumed
+func (w *statusWaiter) Resumed(allocationID, filePath string, op int) {
+	if next, ok := w.next.(PauseCallback); ok {
+		next.Resumed(allocationID, filePath, op)
+	}
+}
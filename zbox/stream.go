@@ -0,0 +1,320 @@
+package zbox
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+const (
+	// blocks kept in memory across all streamed files
+	streamCacheBlocks = 64
+	// blocks downloaded at once, following blocks are read ahead
+	streamReadAheadBlocks = 4
+)
+
+// streamFile - file served by streaming server under random token
+type streamFile struct {
+	token     string
+	meta      *sdk.ConsolidatedFileMeta
+	blockSize int64
+	download  blockDownloader
+	// record - compression record, content is decompressed when it's set
+	record *compressionRecord
+}
+
+type streamingServer struct {
+	listener net.Listener
+	server   *http.Server
+	baseURL  string
+	cache    *blockCache
+
+	mu    sync.Mutex
+	files map[string]*streamFile
+	// token of file by allocation and path
+	tokens map[string]string
+}
+
+var (
+	streamingMu sync.Mutex
+	streaming   *streamingServer
+)
+
+// StartStreamingServer - start loopback HTTP server streaming allocation files, port 0 picks free port.
+// Returns base URL of the server, file URLs are created by Allocation.GetStreamingURL.
+func (s *StorageSDK) StartStreamingServer(port int) (string, error) {
+	streamingMu.Lock()
+	defer streamingMu.Unlock()
+	if streaming != nil {
+		return streaming.baseURL, nil
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return "", err
+	}
+	srv := &streamingServer{
+		listener: listener,
+		baseURL:  "http://" + listener.Addr().String(),
+		cache:    newBlockCache(streamCacheBlocks),
+		files:    make(map[string]*streamFile),
+		tokens:   make(map[string]string),
+	}
+	srv.server = &http.Server{Handler: srv}
+	go srv.server.Serve(listener)
+	streaming = srv
+	return srv.baseURL, nil
+}
+
+// StopStreamingServer - stop streaming server, file URLs become invalid
+func (s *StorageSDK) StopStreamingServer() error {
+	streamingMu.Lock()
+	defer streamingMu.Unlock()
+	if streaming == nil {
+		return fmt.Errorf("streaming server is not running")
+	}
+	err := streaming.server.Close()
+	streaming = nil
+	return err
+}
+
+// GetStreamingURL - URL of remote file on running streaming server, compressed file is streamed decompressed.
+// Seeking back in compressed file decompresses it from the start again.
+func (a *Allocation) GetStreamingURL(remotePath string) (string, error) {
+	return a.streamingURL(a.ID+":"+remotePath, func() (*sdk.ConsolidatedFileMeta, *compressionRecord, blockDownloader, error) {
+		fileMeta, err := a.sdkAllocation.GetFileMeta(remotePath)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		r, err := a.compressionRecord(fileMeta.Hash)
+		return fileMeta, r, a.fileBlockDownloader(remotePath), err
+	})
+}
+
+// GetStreamingURLFromAuthTicket - URL of shared file on running streaming server, shared compressed file
+// is streamed as stored
+func (a *Allocation) GetStreamingURLFromAuthTicket(authTicket, remoteLookupHash, remoteFilename string, rxPay bool) (string, error) {
+	return a.streamingURL(a.ID+":"+remoteLookupHash, func() (*sdk.ConsolidatedFileMeta, *compressionRecord, blockDownloader, error) {
+		fileMeta, err := a.sdkAllocation.GetFileMetaFromAuthTicket(authTicket, remoteLookupHash)
+		return fileMeta, nil, a.sharedBlockDownloader(authTicket, remoteLookupHash, remoteFilename, rxPay), err
+	})
+}
+
+func (a *Allocation) streamingURL(key string, resolve func() (*sdk.ConsolidatedFileMeta, *compressionRecord, blockDownloader, error)) (string, error) {
+	streamingMu.Lock()
+	srv := streaming
+	streamingMu.Unlock()
+	if srv == nil {
+		return "", fmt.Errorf("streaming server is not running")
+	}
+	fileMeta, record, download, err := resolve()
+	if err != nil {
+		return "", err
+	}
+	if fileMeta.Type == "d" {
+		return "", fmt.Errorf("%s is a directory", fileMeta.Path)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	token, ok := srv.tokens[key]
+	if !ok || srv.files[token].meta.Hash != fileMeta.Hash {
+		// new content gets new token, cached blocks of the old one aren't used
+		token = newOperationID()
+		srv.tokens[key] = token
+	}
+	srv.files[token] = &streamFile{
+		token:     token,
+		meta:      fileMeta,
+		blockSize: blockContentSize(a.DataShards, len(fileMeta.EncryptedKey) > 0),
+		download:  download,
+		record:    record,
+	}
+	return srv.baseURL + "/" + token + "/" + url.PathEscape(fileMeta.Name), nil
+}
+
+func (srv *streamingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+	srv.mu.Lock()
+	f, ok := srv.files[token]
+	srv.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if f.record != nil {
+		// stored mime type is the one of compressed content, ServeContent detects it from decompressed one
+		plain := newPlainReader(srv.cache, f, f.record)
+		defer plain.Close()
+		http.ServeContent(w, r, f.meta.Name, time.Time{}, plain)
+		return
+	}
+	if len(f.meta.MimeType) > 0 {
+		w.Header().Set("Content-Type", f.meta.MimeType)
+	}
+	http.ServeContent(w, r, f.meta.Name, time.Time{}, &streamReader{cache: srv.cache, f: f})
+}
+
+// streamReader - seekable view of streamed file backed by block cache
+type streamReader struct {
+	cache  *blockCache
+	f      *streamFile
+	offset int64
+}
+
+func (r *streamReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.f.meta.Size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	if r.offset >= r.f.meta.Size {
+		return 0, io.EOF
+	}
+	block := r.offset/r.f.blockSize + 1
+	data, err := r.cache.get(r.f, block)
+	if err != nil {
+		return 0, err
+	}
+	start := r.offset - (block-1)*r.f.blockSize
+	end := int64(len(data))
+	if rest := r.f.meta.Size - (block-1)*r.f.blockSize; rest < end {
+		end = rest
+	}
+	if start >= end {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, data[start:end])
+	r.offset += int64(n)
+	return n, nil
+}
+
+// blockCache - LRU cache of downloaded blocks, concurrent requests of the same block share one download
+type blockCache struct {
+	mu       sync.Mutex
+	capacity int
+	lru      *list.List
+	blocks   map[string]*list.Element
+	fetching map[string]*blockFetch
+}
+
+type cachedBlock struct {
+	key  string
+	data []byte
+}
+
+type blockFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func newBlockCache(capacity int) *blockCache {
+	return &blockCache{
+		capacity: capacity,
+		lru:      list.New(),
+		blocks:   make(map[string]*list.Element),
+		fetching: make(map[string]*blockFetch),
+	}
+}
+
+func blockKey(token string, block int64) string {
+	return fmt.Sprintf("%s:%d", token, block)
+}
+
+func (c *blockCache) get(f *streamFile, block int64) ([]byte, error) {
+	key := blockKey(f.token, block)
+	c.mu.Lock()
+	for {
+		if el, ok := c.blocks[key]; ok {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			return el.Value.(*cachedBlock).data, nil
+		}
+		fetch, ok := c.fetching[key]
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+		<-fetch.done
+		if fetch.err != nil {
+			return nil, fetch.err
+		}
+		c.mu.Lock()
+	}
+
+	// read ahead until the end of file or a block which is already cached or being fetched
+	fetch := &blockFetch{done: make(chan struct{})}
+	c.fetching[key] = fetch
+	lastBlock := (f.meta.Size-1)/f.blockSize + 1
+	end := block
+	for end < block+streamReadAheadBlocks-1 && end < lastBlock {
+		next := blockKey(f.token, end+1)
+		if _, ok := c.blocks[next]; ok {
+			break
+		}
+		if _, ok := c.fetching[next]; ok {
+			break
+		}
+		c.fetching[next] = fetch
+		end++
+	}
+	c.mu.Unlock()
+
+	data, err := downloadBlocks(f.meta.Name, block, end, f.download)
+
+	c.mu.Lock()
+	var result []byte
+	for b := block; b <= end; b++ {
+		k := blockKey(f.token, b)
+		delete(c.fetching, k)
+		start := (b - block) * f.blockSize
+		if err != nil || start >= int64(len(data)) {
+			continue
+		}
+		stop := start + f.blockSize
+		if stop > int64(len(data)) {
+			stop = int64(len(data))
+		}
+		if b == block {
+			result = data[start:stop]
+		}
+		c.add(k, data[start:stop])
+	}
+	fetch.err = err
+	close(fetch.done)
+	c.mu.Unlock()
+	return result, err
+}
+
+// add caches block evicting the least recently used one, caller holds c.mu
+func (c *blockCache) add(key string, data []byte) {
+	c.blocks[key] = c.lru.PushFront(&cachedBlock{key: key, data: data})
+	if c.lru.Len() > c.capacity {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.blocks, el.Value.(*cachedBlock).key)
+	}
+}
@@ -0,0 +1,183 @@
+package zbox
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+)
+
+// bytes read at once from throttled connection
+const throttleChunkSize = 32 * 1024
+
+// bandwidthLimiter - token bucket shared by all connections it's attached to
+type bandwidthLimiter struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens int64
+	last   time.Time
+}
+
+func (b *bandwidthLimiter) setRate(bytesPerSecond int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rate = bytesPerSecond
+	b.tokens = 0
+	b.last = time.Now()
+}
+
+// wait blocks until n bytes fit into the limit
+func (b *bandwidthLimiter) wait(n int) {
+	b.mu.Lock()
+	if b.rate <= 0 {
+		b.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	b.tokens += int64(now.Sub(b.last).Seconds() * float64(b.rate))
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= int64(n)
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(float64(-b.tokens) / float64(b.rate) * float64(time.Second))
+	}
+	b.mu.Unlock()
+	time.Sleep(delay)
+}
+
+type bandwidthControl struct {
+	once     sync.Once
+	upload   *bandwidthLimiter
+	download *bandwidthLimiter
+
+	mu sync.Mutex
+	// allocations - limiters by throttle key of allocation and direction
+	allocations map[string]*bandwidthLimiter
+}
+
+var bandwidth = &bandwidthControl{
+	upload:      &bandwidthLimiter{},
+	download:    &bandwidthLimiter{},
+	allocations: make(map[string]*bandwidthLimiter),
+}
+
+// install puts throttling client in front of blobber connections
+func (c *bandwidthControl) install() {
+	c.once.Do(func() {
+		zboxutil.Client = &throttledClient{next: zboxutil.Client}
+	})
+}
+
+// setLimit sets limit of the throttle key, 0 drops it
+func (c *bandwidthControl) setLimit(key string, bytesPerSecond int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if bytesPerSecond == 0 {
+		delete(c.allocations, key)
+		return
+	}
+	l, ok := c.allocations[key]
+	if !ok {
+		l = &bandwidthLimiter{}
+		c.allocations[key] = l
+	}
+	l.setRate(bytesPerSecond)
+}
+
+// limiters returns global limiter and limiter of the connection key
+func (c *bandwidthControl) limiters(global *bandwidthLimiter, key string) []*bandwidthLimiter {
+	result := []*bandwidthLimiter{global}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l, ok := c.allocations[key]; ok {
+		result = append(result, l)
+	}
+	return result
+}
+
+// throttleKey - sdk doesn't tag blobber requests with the transfer they belong to and
+// builds their context from the allocation, so connections are matched by
+// direction and allocation taken from request url, the body is never read
+func throttleKey(opType, allocationTx string) string {
+	return opType + ":" + allocationTx
+}
+
+// throttledClient - http client limiting upload and download bytes of blobber requests
+type throttledClient struct {
+	next zboxutil.HttpClient
+}
+
+func (c *throttledClient) Do(req *http.Request) (*http.Response, error) {
+	switch {
+	case req.Body != nil && strings.Contains(req.URL.Path, zboxutil.UPLOAD_ENDPOINT) && (req.Method == http.MethodPost || req.Method == http.MethodPut):
+		key := throttleKey(OpTypeUpload, path.Base(req.URL.Path))
+		req.Body = &throttledReader{reader: req.Body, closer: req.Body, global: bandwidth.upload, key: key}
+		return c.next.Do(req)
+	case strings.Contains(req.URL.Path, zboxutil.DOWNLOAD_ENDPOINT):
+		key := throttleKey(OpTypeDownload, path.Base(req.URL.Path))
+		resp, err := c.next.Do(req)
+		if err == nil && resp.Body != nil {
+			resp.Body = &throttledReader{reader: resp.Body, closer: resp.Body, global: bandwidth.download, key: key}
+		}
+		return resp, err
+	default:
+		return c.next.Do(req)
+	}
+}
+
+// throttledReader - limits are looked up on every read so they can be changed at runtime
+type throttledReader struct {
+	reader io.Reader
+	closer io.Closer
+	global *bandwidthLimiter
+	key    string
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkSize {
+		p = p[:throttleChunkSize]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		for _, l := range bandwidth.limiters(r.global, r.key) {
+			l.wait(n)
+		}
+	}
+	return n, err
+}
+
+func (r *throttledReader) Close() error {
+	return r.closer.Close()
+}
+
+// SetBandwidthLimits - set global upload and download limits in bytes per second, 0 removes the limit
+func (s *StorageSDK) SetBandwidthLimits(uploadBytesPerSecond, downloadBytesPerSecond int64) error {
+	if uploadBytesPerSecond < 0 || downloadBytesPerSecond < 0 {
+		return fmt.Errorf("invalid bandwidth limit")
+	}
+	bandwidth.install()
+	bandwidth.upload.setRate(uploadBytesPerSecond)
+	bandwidth.download.setRate(downloadBytesPerSecond)
+	return nil
+}
+
+// SetBandwidthLimits - limit upload and download bytes per second of blobber connections of the allocation,
+// 0 removes the limit. Global limits still apply. sdk sends requests of all transfers through one client
+// and doesn't tag them, so the limit is shared by all uploads or downloads of the allocation.
+func (a *Allocation) SetBandwidthLimits(uploadBytesPerSecond, downloadBytesPerSecond int64) error {
+	if uploadBytesPerSecond < 0 || downloadBytesPerSecond < 0 {
+		return fmt.Errorf("invalid bandwidth limit")
+	}
+	bandwidth.install()
+	bandwidth.setLimit(throttleKey(OpTypeUpload, a.sdkAllocation.Tx), uploadBytesPerSecond)
+	bandwidth.setLimit(throttleKey(OpTypeDownload, a.sdkAllocation.Tx), downloadBytesPerSecond)
+	return nil
+}
@@ -0,0 +1,60 @@
+package zbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiterWait(t *testing.T) {
+	l := &bandwidthLimiter{}
+	l.setRate(100 * 1024)
+
+	start := time.Now()
+	// first 20KB have to wait for tokens, 200ms at 100KB/s
+	l.wait(10 * 1024)
+	l.wait(10 * 1024)
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("expected about 200ms wait, got %v", elapsed)
+	}
+
+	// unused tokens are capped to one second of rate
+	l.mu.Lock()
+	l.last = time.Now().Add(-time.Hour)
+	l.mu.Unlock()
+	l.wait(1)
+	l.mu.Lock()
+	tokens := l.tokens
+	l.mu.Unlock()
+	if tokens > 100*1024 {
+		t.Fatalf("expected tokens capped to rate, got %d", tokens)
+	}
+
+	// removed limit doesn't wait
+	l.setRate(0)
+	start = time.Now()
+	l.wait(1 << 30)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("expected no wait without limit, got %v", elapsed)
+	}
+}
+
+func TestBandwidthLimitersByKey(t *testing.T) {
+	upload := throttleKey(OpTypeUpload, "tx")
+	download := throttleKey(OpTypeDownload, "tx")
+	bandwidth.setLimit(upload, 1024)
+	defer bandwidth.setLimit(upload, 0)
+
+	if n := len(bandwidth.limiters(bandwidth.upload, upload)); n != 2 {
+		t.Fatalf("expected global and allocation limiters, got %d", n)
+	}
+	if n := len(bandwidth.limiters(bandwidth.download, download)); n != 1 {
+		t.Fatalf("expected only global limiter for downloads, got %d", n)
+	}
+	if n := len(bandwidth.limiters(bandwidth.upload, throttleKey(OpTypeUpload, "other"))); n != 1 {
+		t.Fatalf("expected only global limiter for other allocation, got %d", n)
+	}
+	bandwidth.setLimit(upload, 0)
+	if n := len(bandwidth.limiters(bandwidth.upload, upload)); n != 1 {
+		t.Fatalf("expected removed limit to be dropped, got %d", n)
+	}
+}
@@ -0,0 +1,285 @@
+package zbox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif" // register GIF decoder
+	"image/jpeg"
+	_ "image/png" // register PNG decoder
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register WebP decoder
+)
+
+const (
+	defaultThumbnailMaxDimension = 256
+	defaultThumbnailQuality      = 80
+
+	// maxThumbnailSourcePixels - images with more pixels aren't decoded, decoded image is kept in memory whole
+	maxThumbnailSourcePixels = 50 * 1000 * 1000
+)
+
+// ThumbnailOptions - options of generated thumbnail
+type ThumbnailOptions struct {
+	// MaxDimension - max width and height in pixels, aspect ratio is kept
+	MaxDimension int `json:"max_dimension,omitempty"`
+	// Quality - JPEG quality 1-100
+	Quality int `json:"quality,omitempty"`
+}
+
+// GenerateThumbnail - write JPEG thumbnail of JPEG, PNG, GIF or WebP image at localPath to thumbnailPath.
+// maxDimension and quality are defaulted when 0, JPEG is rotated by its EXIF orientation.
+// Images over 50 megapixels are rejected before they are decoded.
+func GenerateThumbnail(localPath, thumbnailPath string, maxDimension, quality int) error {
+	return generateThumbnail(localPath, thumbnailPath, &ThumbnailOptions{MaxDimension: maxDimension, Quality: quality})
+}
+
+func generateThumbnail(localPath, thumbnailPath string, opts *ThumbnailOptions) error {
+	maxDimension, quality := opts.MaxDimension, opts.Quality
+	if maxDimension <= 0 {
+		maxDimension = defaultThumbnailMaxDimension
+	}
+	if quality <= 0 {
+		quality = defaultThumbnailQuality
+	}
+	if quality > 100 {
+		return fmt.Errorf("invalid thumbnail quality %d", quality)
+	}
+	data, err := ioutil.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode image %s. %v", localPath, err)
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > maxThumbnailSourcePixels {
+		return fmt.Errorf("image %s of %dx%d pixels exceeds limit of %d pixels", localPath, config.Width, config.Height, maxThumbnailSourcePixels)
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode image %s. %v", localPath, err)
+	}
+	thumbnail := scaleImage(img, maxDimension)
+	if format == "jpeg" {
+		thumbnail = orientImage(thumbnail, jpegOrientation(data))
+	}
+	buf := &bytes.Buffer{}
+	if err = jpeg.Encode(buf, thumbnail, &jpeg.Options{Quality: quality}); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(thumbnailPath, buf.Bytes(), 0600)
+}
+
+func parseThumbnailOptions(options string) (*ThumbnailOptions, error) {
+	opts := &ThumbnailOptions{}
+	if len(options) > 0 {
+		if err := json.Unmarshal([]byte(options), opts); err != nil {
+			return nil, fmt.Errorf("invalid thumbnail options JSON. %v", err)
+		}
+	}
+	return opts, nil
+}
+
+// scaleImage downscales image to fit maxDimension, transparent pixels are put on white background
+func scaleImage(src image.Image, maxDimension int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	nw, nh := w, h
+	if w > maxDimension || h > maxDimension {
+		if w >= h {
+			nw, nh = maxDimension, h*maxDimension/w
+		} else {
+			nw, nh = w*maxDimension/h, maxDimension
+		}
+	}
+	if nw < 1 {
+		nw = 1
+	}
+	if nh < 1 {
+		nh = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+	return dst
+}
+
+// jpegOrientation returns EXIF orientation 1-8 of JPEG data, 1 when it's missing
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// fill byte
+			i++
+			continue
+		case marker == 0xDA || marker == 0xD9:
+			// image data starts, EXIF comes before it
+			return 1
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			i += 2
+			continue
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(segment) >= 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// exifOrientation reads orientation tag of the first IFD of TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// orientImage flips and rotates image stored with EXIF orientation so it's displayed upright
+func orientImage(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			si, di := src.PixOffset(sx, sy), dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// newThumbnail generates thumbnail into spool dir, returned dir has to be removed by caller
+func newThumbnail(localPath string, opts *ThumbnailOptions) (string, string, error) {
+	dir, err := newSpoolDir("thumbnail")
+	if err != nil {
+		return "", "", err
+	}
+	thumbnailPath := filepath.Join(dir, filepath.Base(localPath)+".thumb.jpg")
+	if err = generateThumbnail(localPath, thumbnailPath, opts); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return thumbnailPath, dir, nil
+}
+
+// uploadWithThumbnail generates thumbnail of localPath and removes it once upload is finished
+func uploadWithThumbnail(localPath, options string, statusCb StatusCallback, upload func(thumbnailPath string, statusCb StatusCallback) (*Operation, error)) (*Operation, error) {
+	opts, err := parseThumbnailOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	thumbnailPath, dir, err := newThumbnail(localPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	w := newStatusWaiter(statusCb)
+	op, err := upload(thumbnailPath, w)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	go func() {
+		w.wait()
+		os.RemoveAll(dir)
+	}()
+	return op, nil
+}
+
+// UploadFileWithGeneratedThumbnail - start upload file with thumbnail generated from the image,
+// thumbnailOptions is ThumbnailOptions JSON
+func (a *Allocation) UploadFileWithGeneratedThumbnail(localPath, remotePath, fileAttrs, thumbnailOptions string, statusCb StatusCallback) (*Operation, error) {
+	return uploadWithThumbnail(localPath, thumbnailOptions, statusCb, func(thumbnailPath string, cb StatusCallback) (*Operation, error) {
+		return a.UploadFileWithThumbnail(localPath, remotePath, fileAttrs, thumbnailPath, cb)
+	})
+}
+
+// EncryptAndUploadFileWithGeneratedThumbnail - start upload encrypted file with thumbnail generated from the image
+func (a *Allocation) EncryptAndUploadFileWithGeneratedThumbnail(localPath, remotePath, fileAttrs, thumbnailOptions string, statusCb StatusCallback) (*Operation, error) {
+	return uploadWithThumbnail(localPath, thumbnailOptions, statusCb, func(thumbnailPath string, cb StatusCallback) (*Operation, error) {
+		return a.EncryptAndUploadFileWithThumbnail(localPath, remotePath, fileAttrs, thumbnailPath, cb)
+	})
+}
+
+// UpdateFileWithGeneratedThumbnail - update file with thumbnail generated from the image
+func (a *Allocation) UpdateFileWithGeneratedThumbnail(localPath, remotePath, fileAttrs, thumbnailOptions string, statusCb StatusCallback) (*Operation, error) {
+	return uploadWithThumbnail(localPath, thumbnailOptions, statusCb, func(thumbnailPath string, cb StatusCallback) (*Operation, error) {
+		return a.UpdateFileWithThumbnail(localPath, remotePath, fileAttrs, thumbnailPath, cb)
+	})
+}
+
+// EncryptAndUpdateFileWithGeneratedThumbnail - update encrypted file with thumbnail generated from the image
+func (a *Allocation) EncryptAndUpdateFileWithGeneratedThumbnail(localPath, remotePath, fileAttrs, thumbnailOptions string, statusCb StatusCallback) (*Operation, error) {
+	return uploadWithThumbnail(localPath, thumbnailOptions, statusCb, func(thumbnailPath string, cb StatusCallback) (*Operation, error) {
+		return a.EncryptAndUpdateFileWithThumbnail(localPath, remotePath, fileAttrs, thumbnailPath, cb)
+	})
+}
@@ -0,0 +1,147 @@
+package zbox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// exifJpeg returns JPEG with APP1 segment holding orientation tag
+func exifJpeg(t *testing.T, img image.Image, order binary.ByteOrder, orientation uint16) []byte {
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+	data := buf.Bytes()
+	result := append([]byte{}, data[:2]...)
+	result = append(result, app1...)
+	result = append(result, segment...)
+	return append(result, data[2:]...)
+}
+
+func TestJpegOrientation(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	if o := jpegOrientation(exifJpeg(t, img, binary.BigEndian, 6)); o != 6 {
+		t.Fatalf("expected orientation 6, got %d", o)
+	}
+	if o := jpegOrientation(exifJpeg(t, img, binary.LittleEndian, 8)); o != 8 {
+		t.Fatalf("expected orientation 8, got %d", o)
+	}
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if o := jpegOrientation(buf.Bytes()); o != 1 {
+		t.Fatalf("expected orientation 1 without EXIF, got %d", o)
+	}
+}
+
+func TestOrientImage(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	tests := []struct {
+		orientation int
+		bounds      image.Rectangle
+		first       color.RGBA
+	}{
+		{1, image.Rect(0, 0, 2, 1), red},
+		{2, image.Rect(0, 0, 2, 1), blue},
+		{3, image.Rect(0, 0, 2, 1), blue},
+		{6, image.Rect(0, 0, 1, 2), red},
+		{8, image.Rect(0, 0, 1, 2), blue},
+	}
+	for _, tt := range tests {
+		dst := orientImage(src, tt.orientation)
+		if dst.Bounds() != tt.bounds {
+			t.Fatalf("orientation %d: expected bounds %v, got %v", tt.orientation, tt.bounds, dst.Bounds())
+		}
+		if c := dst.RGBAAt(0, 0); c != tt.first {
+			t.Fatalf("orientation %d: unexpected first pixel %v", tt.orientation, c)
+		}
+	}
+}
+
+func TestGenerateThumbnailRotatesJpeg(t *testing.T) {
+	dir, err := ioutil.TempDir("", "thumbnail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	localPath := filepath.Join(dir, "photo.jpg")
+	if err = ioutil.WriteFile(localPath, exifJpeg(t, img, binary.BigEndian, 6), 0600); err != nil {
+		t.Fatal(err)
+	}
+	thumbnailPath := filepath.Join(dir, "thumb.jpg")
+	if err = GenerateThumbnail(localPath, thumbnailPath, 10, 0); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(thumbnailPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, err := jpeg.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 5 || cfg.Height != 10 {
+		t.Fatalf("expected rotated 5x10 thumbnail, got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestGenerateThumbnailRejectsHugeImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "thumbnail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 1x1 PNG with IHDR claiming 10000x10000 pixels
+	buf := &bytes.Buffer{}
+	if err = png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 10000)
+	binary.BigEndian.PutUint32(data[20:], 10000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	localPath := filepath.Join(dir, "huge.png")
+	if err = ioutil.WriteFile(localPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = GenerateThumbnail(localPath, filepath.Join(dir, "thumb.jpg"), 0, 0)
+	if err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Fatalf("expected pixel limit error, got %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+package zbox
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// trashRoot - hidden allocation dir keeping deleted objects. Every deleted object is kept in its own dir
+// named by deletion time, type, size and encoded original path, e.g. /.trash/<unix nanos>_f_<size>_<base64 path>/b.txt.
+// Size of deleted dir is summed once on delete, so listing of trash doesn't walk the entries.
+// Sdk moves objects by copy and delete, so moving into and out of trash costs a copy of the object and
+// an interrupted move may leave the object in both places.
+const trashRoot = "/.trash"
+
+// TrashItem - object deleted into trash
+type TrashItem struct {
+	// ID - trash entry id used by RestoreFromTrash
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	OriginalPath string `json:"original_path"`
+	// Path - current path of the object in trash
+	Path string `json:"path"`
+	// Type - f for file, d for directory
+	Type string `json:"type"`
+	// Size - size of the file or total size of files in the directory
+	Size      int64 `json:"size"`
+	DeletedAt int64 `json:"deleted_at"`
+}
+
+// trashEntry - trash entry decoded from its name
+type trashEntry struct {
+	originalPath string
+	deletedAt    time.Time
+	// objType - f for file, d for directory
+	objType string
+	size    int64
+}
+
+var (
+	trashMu      sync.Mutex
+	trashEnabled bool
+	// trashMaxAge - entries older than this are purged by PurgeTrash, 0 keeps them until EmptyTrash
+	trashMaxAge time.Duration
+	// trashLocks - serialize trash operations by allocation id
+	trashLocks = make(map[string]*sync.Mutex)
+)
+
+// SetTrash - make DeleteFile move objects to trash instead of deleting them. Nothing is purged in background,
+// entries older than purgeAfterSeconds are deleted by PurgeTrash, 0 keeps them until EmptyTrash.
+func (s *StorageSDK) SetTrash(enabled bool, purgeAfterSeconds int64) error {
+	if purgeAfterSeconds < 0 {
+		return fmt.Errorf("invalid purge age %d", purgeAfterSeconds)
+	}
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	trashEnabled = enabled
+	trashMaxAge = time.Duration(purgeAfterSeconds) * time.Second
+	return nil
+}
+
+func trashSettings() (bool, time.Duration) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	return trashEnabled, trashMaxAge
+}
+
+// trashLock returns lock serializing trash operations of the allocation
+func trashLock(allocationID string) *sync.Mutex {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	lock, ok := trashLocks[allocationID]
+	if !ok {
+		lock = &sync.Mutex{}
+		trashLocks[allocationID] = lock
+	}
+	return lock
+}
+
+func isTrashPath(remotePath string) bool {
+	p := path.Clean("/" + remotePath)
+	return p == trashRoot || strings.HasPrefix(p, trashRoot+"/")
+}
+
+func trashEntryName(e *trashEntry) string {
+	return fmt.Sprintf("%d_%s_%d_%s", e.deletedAt.UnixNano(), e.objType, e.size, base64.RawURLEncoding.EncodeToString([]byte(e.originalPath)))
+}
+
+// parseTrashEntry decodes trash entry name
+func parseTrashEntry(name string) (*trashEntry, error) {
+	parts := strings.SplitN(name, "_", 4)
+	if len(parts) != 4 || (parts[1] != "f" && parts[1] != "d") {
+		return nil, fmt.Errorf("invalid trash entry %s", name)
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trash entry %s", name)
+	}
+	size, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("invalid trash entry %s", name)
+	}
+	originalPath, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid trash entry %s", name)
+	}
+	return &trashEntry{originalPath: string(originalPath), deletedAt: time.Unix(0, nanos), objType: parts[1], size: size}, nil
+}
+
+// moveToTrash moves object into new trash entry
+func (a *Allocation) moveToTrash(remotePath string) error {
+	lock := trashLock(a.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	originalPath := path.Clean("/" + remotePath)
+	fileMeta, err := a.remote().GetFileMeta(originalPath)
+	if err != nil {
+		return err
+	}
+	e := &trashEntry{originalPath: originalPath, deletedAt: time.Now(), objType: "f", size: fileMeta.ActualFileSize}
+	if fileMeta.Type == "d" {
+		e.objType = "d"
+		// meta of dir holds size stored across blobbers, sizes of its files are summed
+		if e.size, err = a.treeSize(originalPath); err != nil {
+			return err
+		}
+	}
+	entry := path.Join(trashRoot, trashEntryName(e))
+	if err := a.remote().CreateDir(entry); err != nil {
+		return err
+	}
+	if err := a.remote().MoveObject(originalPath, entry); err != nil {
+		// original is deleted only after it's copied, so the entry with a possible copy is dropped
+		if derr := a.remote().DeleteFile(entry); derr != nil {
+			l.Logger.Error("failed to remove trash entry ", entry, ": ", derr)
+		}
+		return fmt.Errorf("failed to move %s to trash. %v", originalPath, err)
+	}
+	return nil
+}
+
+// listTrash lists trash entries, caller holds trash lock
+func (a *Allocation) listTrash() ([]*TrashItem, error) {
+	if _, err := a.remote().GetFileMeta(trashRoot); err != nil {
+		// nothing was deleted yet
+		return []*TrashItem{}, nil
+	}
+	listResult, err := a.remote().ListDir(trashRoot)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*TrashItem, 0, len(listResult.Children))
+	for _, child := range listResult.Children {
+		e, err := parseTrashEntry(child.Name)
+		if err != nil {
+			continue
+		}
+		items = append(items, &TrashItem{
+			ID:           child.Name,
+			Name:         path.Base(e.originalPath),
+			OriginalPath: e.originalPath,
+			Path:         path.Join(child.Path, path.Base(e.originalPath)),
+			Type:         e.objType,
+			Size:         e.size,
+			DeletedAt:    e.deletedAt.Unix(),
+		})
+	}
+	// newest first
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt > items[j].DeletedAt || (items[i].DeletedAt == items[j].DeletedAt && items[i].ID > items[j].ID)
+	})
+	return items, nil
+}
+
+// treeSize sums actual sizes of files in remote dir and its subdirs
+func (a *Allocation) treeSize(remoteDir string) (int64, error) {
+	listResult, err := a.remote().ListDir(remoteDir)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, child := range listResult.Children {
+		if child.Type != "d" {
+			size += child.ActualSize
+			continue
+		}
+		n, err := a.treeSize(child.Path)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	return size, nil
+}
+
+// purgeTrash deletes trash entries older than maxAge, all of them when maxAge is 0
+func (a *Allocation) purgeTrash(maxAge time.Duration) (int, error) {
+	lock := trashLock(a.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	items, err := a.listTrash()
+	if err != nil {
+		return 0, err
+	}
+	oldest := time.Now().Add(-maxAge).Unix()
+	purged := 0
+	for _, item := range items {
+		if maxAge > 0 && item.DeletedAt >= oldest {
+			continue
+		}
+		if err = a.remote().DeleteFile(path.Join(trashRoot, item.ID)); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// PurgeTrash - permanently delete trash entries older than purge age set by SetTrash, returns number of deleted
+// entries. Nothing is deleted when purge age is 0.
+func (a *Allocation) PurgeTrash() (int, error) {
+	_, maxAge := trashSettings()
+	if maxAge == 0 {
+		return 0, nil
+	}
+	return a.purgeTrash(maxAge)
+}
+
+// ListTrash - list objects in trash, newest first. Returns TrashItem list JSON.
+func (a *Allocation) ListTrash() (string, error) {
+	lock := trashLock(a.ID)
+	lock.Lock()
+	items, err := a.listTrash()
+	lock.Unlock()
+	if err != nil {
+		return "", err
+	}
+	retBytes, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return string(retBytes), nil
+}
+
+// RestoreFromTrash - move object of trash entry back to its original path, fails when the path is taken
+func (a *Allocation) RestoreFromTrash(id string) error {
+	e, err := parseTrashEntry(id)
+	if err != nil {
+		return err
+	}
+	lock := trashLock(a.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	originalPath := e.originalPath
+	if _, err = a.remote().GetFileMeta(originalPath); err == nil {
+		return fmt.Errorf("%s already exists", originalPath)
+	}
+	entry := path.Join(trashRoot, id)
+	trashed := path.Join(entry, path.Base(originalPath))
+	if _, err = a.remote().GetFileMeta(trashed); err != nil {
+		return fmt.Errorf("trash entry %s not found. %v", id, err)
+	}
+	if err = a.ensureRemoteDir(path.Dir(originalPath)); err != nil {
+		return err
+	}
+	if err = a.remote().MoveObject(trashed, path.Dir(originalPath)); err != nil {
+		// restored copy is kept when only the delete of trashed object failed
+		if _, merr := a.remote().GetFileMeta(originalPath); merr != nil {
+			return err
+		}
+	}
+	return a.remote().DeleteFile(entry)
+}
+
+// EmptyTrash - permanently delete all objects in trash, returns number of deleted entries
+func (a *Allocation) EmptyTrash() (int, error) {
+	return a.purgeTrash(0)
+}
@@ -0,0 +1,93 @@
+package zbox
+
+import (
+	"encoding/json"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestParseTrashEntry(t *testing.T) {
+	deletedAt := time.Unix(1600000000, 123456789)
+	// encoded paths may hold separator and url safe chars
+	for _, originalPath := range []string{"/a.txt", "/dir/sub dir/b_c.txt", "/??>>/~~~"} {
+		e := &trashEntry{originalPath: originalPath, deletedAt: deletedAt, objType: "d", size: 1234}
+		parsed, err := parseTrashEntry(trashEntryName(e))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.originalPath != originalPath || !parsed.deletedAt.Equal(deletedAt) || parsed.objType != "d" || parsed.size != 1234 {
+			t.Fatalf("expected %+v, got %+v", e, parsed)
+		}
+	}
+	for _, name := range []string{"notes.txt", "123", "123_L2EudHh0", "x_f_1_L2EudHh0", "123_x_1_L2EudHh0", "123_f_-1_L2EudHh0", "123_f_1_L2E+dHh0", "123_f_1_L2EudHh0="} {
+		if _, err := parseTrashEntry(name); err == nil {
+			t.Fatalf("%s parsed as trash entry", name)
+		}
+	}
+}
+
+func TestListTrashDoesNotWalkOrPurge(t *testing.T) {
+	trashMu.Lock()
+	trashMaxAge = time.Hour
+	trashMu.Unlock()
+	defer func() {
+		trashMu.Lock()
+		trashMaxAge = 0
+		trashMu.Unlock()
+	}()
+	files := newTestRemoteFiles()
+	a := &Allocation{ID: "trash-alloc", files: files}
+	files.addFile("/dir/a.txt", 10, "a")
+	files.addFile("/dir/sub/b.txt", 20, "b")
+	files.addFile("/c.txt", 5, "c")
+	if err := a.moveToTrash("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.moveToTrash("/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// expired entry
+	old := &trashEntry{originalPath: "/old.txt", deletedAt: time.Now().Add(-2 * time.Hour), objType: "f", size: 1}
+	files.addFile(path.Join(trashRoot, trashEntryName(old), "old.txt"), 1, "old")
+
+	listCalls := files.callCount("ListDir")
+	result, err := a.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := files.callCount("ListDir") - listCalls; n != 1 {
+		t.Fatalf("expected trash to be listed by one call, got %d", n)
+	}
+	var items []*TrashItem
+	if err = json.Unmarshal([]byte(result), &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("expected expired entry to be listed till purge, got %d items", len(items))
+	}
+	sizes := make(map[string]*TrashItem)
+	for _, item := range items {
+		sizes[item.OriginalPath] = item
+	}
+	if d := sizes["/dir"]; d == nil || d.Type != "d" || d.Size != 30 {
+		t.Fatalf("expected dir of 30 bytes, got %+v", d)
+	}
+	if c := sizes["/c.txt"]; c == nil || c.Type != "f" || c.Size != 5 {
+		t.Fatalf("expected file of 5 bytes, got %+v", c)
+	}
+
+	purged, err := a.PurgeTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 || files.get(path.Join(trashRoot, trashEntryName(old))) != nil {
+		t.Fatalf("expected expired entry to be purged, purged %d", purged)
+	}
+	if err = a.RestoreFromTrash(sizes["/dir"].ID); err != nil {
+		t.Fatal(err)
+	}
+	if f := files.get("/dir/sub/b.txt"); f == nil {
+		t.Fatal("expected dir to be restored")
+	}
+}
@@ -0,0 +1,84 @@
+package zbox
+
+import (
+	"os"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+// OpUnchanged - op code of Completed reported when upload is skipped as remote file has the same content
+const OpUnchanged = 100
+
+// remoteUnchanged compares local file with remote one, compressed remote file is compared by its original
+// content. fileMeta is nil when remote file doesn't exist.
+func (a *Allocation) remoteUnchanged(localPath, remotePath string) (*sdk.ConsolidatedFileMeta, bool, error) {
+	fi, err := os.Stat(localPath)
+	if err != nil {
+		return nil, false, err
+	}
+	fileMeta, err := a.remoteFileMeta(remotePath)
+	if err != nil || fileMeta == nil {
+		return nil, false, err
+	}
+	if fileMeta.Type == "d" {
+		return fileMeta, false, nil
+	}
+	size, remoteHash := fileMeta.Size, fileMeta.Hash
+	r, err := a.compressionRecord(fileMeta.Hash)
+	if err != nil {
+		return nil, false, err
+	}
+	if r != nil {
+		size, remoteHash = r.Size, r.PlainHash
+	}
+	if size != fi.Size() {
+		return fileMeta, false, nil
+	}
+	hash, err := fileSha1(localPath)
+	if err != nil {
+		return nil, false, err
+	}
+	return fileMeta, hash == remoteHash, nil
+}
+
+// skipUnchanged reports started and completed upload without transferring the file, callbacks are
+// called asynchronously like for transferred uploads
+func (a *Allocation) skipUnchanged(localPath, remotePath string, fileMeta *sdk.ConsolidatedFileMeta, statusCb StatusCallback) *Operation {
+	op := a.newOperation(OpTypeUpload, localPath, remotePath, statusCb)
+	go func() {
+		op.Started(a.ID, remotePath, OpUnchanged, int(fileMeta.Size))
+		op.Completed(a.ID, remotePath, fileMeta.Name, fileMeta.MimeType, int(fileMeta.Size), OpUnchanged)
+	}()
+	return op
+}
+
+// UploadFileIfChanged - upload file unless remote file has the same content hash, skipped upload is
+// reported by Started and Completed with OpUnchanged op code. Existing remote file with other content is updated.
+func (a *Allocation) UploadFileIfChanged(workdir, localPath, remotePath, fileAttrs string, statusCb StatusCallback) (*Operation, error) {
+	fileMeta, unchanged, err := a.remoteUnchanged(localPath, remotePath)
+	switch {
+	case err != nil:
+		return nil, err
+	case unchanged:
+		return a.skipUnchanged(localPath, remotePath, fileMeta, statusCb), nil
+	case fileMeta != nil:
+		return a.UpdateFile(localPath, remotePath, fileAttrs, statusCb)
+	default:
+		return a.UploadFile(workdir, localPath, remotePath, fileAttrs, statusCb)
+	}
+}
+
+// EncryptAndUploadFileIfChanged - upload encrypted file unless remote file has the same content hash
+func (a *Allocation) EncryptAndUploadFileIfChanged(localPath, remotePath, fileAttrs string, statusCb StatusCallback) (*Operation, error) {
+	fileMeta, unchanged, err := a.remoteUnchanged(localPath, remotePath)
+	switch {
+	case err != nil:
+		return nil, err
+	case unchanged:
+		return a.skipUnchanged(localPath, remotePath, fileMeta, statusCb), nil
+	case fileMeta != nil:
+		return a.EncryptAndUpdateFile(localPath, remotePath, fileAttrs, statusCb)
+	default:
+		return a.EncryptAndUploadFile(localPath, remotePath, fileAttrs, statusCb)
+	}
+}
@@ -1,6 +1,7 @@
 package zbox
 
 import (
+	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -8,6 +9,10 @@ import (
 	"github.com/0chain/gosdk/zboxcore/sdk"
 	"github.com/0chain/gosdk/zboxcore/zboxutil"
 	"github.com/0chain/gosdk/zcncore"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
 )
 
@@ -91,3 +96,106 @@ func Sign(hash string) (string, error) {
 func VerifySignature(signature string, msg string) (bool, error) {
 	return client.VerifySignature(signature, msg)
 }
+
+// writeFileAtomic writes data to unique temp file and renames it, so readers never see partial content
+// and concurrent writers never share temp file
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+type txnStatusCallback struct {
+	done   chan struct{}
+	status int
+}
+
+func (cb *txnStatusCallback) OnTransactionComplete(t *zcncore.Transaction, status int) {
+	cb.status = status
+	cb.done <- struct{}{}
+}
+
+func (cb *txnStatusCallback) OnVerifyComplete(t *zcncore.Transaction, status int) {
+	cb.status = status
+	cb.done <- struct{}{}
+}
+
+func (cb *txnStatusCallback) OnAuthComplete(t *zcncore.Transaction, status int) {}
+
+// submitSmartContract submits smart contract transaction and returns its hash once miners accepted it
+func submitSmartContract(address, method string, input interface{}, value, fee int64) (string, error) {
+	inputBytes, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+	cb := &txnStatusCallback{done: make(chan struct{}, 1)}
+	txn, err := zcncore.NewTransaction(cb, fee)
+	if err != nil {
+		return "", err
+	}
+	if err = txn.ExecuteSmartContract(address, method, string(inputBytes), value); err != nil {
+		return "", err
+	}
+	<-cb.done
+	if cb.status != zcncore.StatusSuccess {
+		return "", fmt.Errorf("%s transaction failed. %s", method, txn.GetTransactionError())
+	}
+	hash := txn.GetTransactionHash()
+	if len(hash) == 0 {
+		return "", fmt.Errorf("%s transaction hash is missing", method)
+	}
+	return hash, nil
+}
+
+// verifyTransaction waits until transaction is confirmed by sharders
+func verifyTransaction(hash string) error {
+	cb := &txnStatusCallback{done: make(chan struct{}, 1)}
+	txn, err := zcncore.NewTransaction(cb, 0)
+	if err != nil {
+		return err
+	}
+	if err = txn.SetTransactionHash(hash); err != nil {
+		return err
+	}
+	if err = txn.Verify(); err != nil {
+		return err
+	}
+	<-cb.done
+	if cb.status != zcncore.StatusSuccess {
+		return fmt.Errorf("transaction %s verify failed. %s", hash, txn.GetVerifyError())
+	}
+	return nil
+}
+
+// fileSha1 calculates hex encoded sha1 of local file content, same as actual file hash of uploaded file
+func fileSha1(localPath string) (string, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,134 @@
+package zbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	l "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// Handling of downloads failing content hash check
+const (
+	// VerifyDelete - mismatching file is deleted, default
+	VerifyDelete = "delete"
+	// VerifyQuarantine - mismatching file is moved to quarantine dir
+	VerifyQuarantine = "quarantine"
+)
+
+// IntegrityError - local file content doesn't match remote content hash
+type IntegrityError struct {
+	LocalPath    string
+	ExpectedHash string
+	ActualHash   string
+	// QuarantinePath - where mismatching file was moved, empty when it was deleted or kept
+	QuarantinePath string
+	// ExpectedSize and ActualSize are set when size of decompressed content doesn't match, hash isn't computed then
+	ExpectedSize int64
+	ActualSize   int64
+}
+
+func (e *IntegrityError) Error() string {
+	msg := fmt.Sprintf("integrity check failed for %s: expected hash %s, got %s", e.LocalPath, e.ExpectedHash, e.ActualHash)
+	if e.ExpectedSize != e.ActualSize {
+		msg = fmt.Sprintf("integrity check failed for %s: expected %d bytes, got %d", e.LocalPath, e.ExpectedSize, e.ActualSize)
+	}
+	if len(e.QuarantinePath) > 0 {
+		msg += ", quarantined to " + e.QuarantinePath
+	}
+	return msg
+}
+
+var (
+	verifyMu   sync.Mutex
+	verifyMode = VerifyDelete
+)
+
+// SetDownloadVerification - set handling of resumable downloads failing content hash check, delete or quarantine.
+// Quarantined files are moved to quarantine dir of SDK work dir. Other whole file downloads are checked by sdk,
+// which deletes mismatching file itself.
+func (s *StorageSDK) SetDownloadVerification(mode string) error {
+	switch mode {
+	case VerifyDelete, VerifyQuarantine:
+	default:
+		return fmt.Errorf("unknown verification mode %s", mode)
+	}
+	verifyMu.Lock()
+	defer verifyMu.Unlock()
+	verifyMode = mode
+	return nil
+}
+
+func downloadVerification() string {
+	verifyMu.Lock()
+	defer verifyMu.Unlock()
+	return verifyMode
+}
+
+// VerifyLocalFile - compare hash of local file with content hash of remote file, IntegrityError is returned on mismatch.
+// Compressed remote file is compared by size and hash of its decompressed content. Local file is kept either way.
+func (a *Allocation) VerifyLocalFile(localPath, remotePath string) error {
+	fileMeta, err := a.sdkAllocation.GetFileMeta(remotePath)
+	if err != nil {
+		return err
+	}
+	if fileMeta.Type == "d" {
+		return fmt.Errorf("%s is a directory", remotePath)
+	}
+	r, err := a.compressionRecord(fileMeta.Hash)
+	if err != nil {
+		return err
+	}
+	return verifyContent(localPath, fileMeta.Hash, r)
+}
+
+// verifyContent checks local file against stored content hash, or decompressed content of compression record
+func verifyContent(localPath, hash string, r *compressionRecord) error {
+	if r == nil {
+		return verifyFile(localPath, hash)
+	}
+	stat, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	if stat.Size() != r.Size {
+		return &IntegrityError{LocalPath: localPath, ExpectedHash: r.PlainHash, ExpectedSize: r.Size, ActualSize: stat.Size()}
+	}
+	return verifyFile(localPath, r.PlainHash)
+}
+
+func verifyFile(localPath, expectedHash string) error {
+	hash, err := fileSha1(localPath)
+	if err != nil {
+		return err
+	}
+	if hash != expectedHash {
+		return &IntegrityError{LocalPath: localPath, ExpectedHash: expectedHash, ActualHash: hash}
+	}
+	return nil
+}
+
+// discardCorrupted deletes or quarantines local file which failed verification
+func discardCorrupted(e *IntegrityError, mode string) {
+	if mode == VerifyQuarantine {
+		dir := filepath.Join(workDir, "quarantine")
+		if len(workDir) == 0 {
+			dir = filepath.Join(os.TempDir(), "zbox-quarantine")
+		}
+		quarantinePath := filepath.Join(dir, fmt.Sprintf("%d-%s", time.Now().UnixNano(), filepath.Base(e.LocalPath)))
+		err := os.MkdirAll(dir, 0700)
+		if err == nil {
+			err = os.Rename(e.LocalPath, quarantinePath)
+		}
+		if err == nil {
+			e.QuarantinePath = quarantinePath
+			return
+		}
+		l.Logger.Error("failed to quarantine file, it's deleted: ", err)
+	}
+	if err := os.Remove(e.LocalPath); err != nil {
+		l.Logger.Error("failed to remove corrupted file: ", err)
+	}
+}
@@ -0,0 +1,284 @@
+package zbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	l "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+// versionsRoot - hidden allocation dir keeping previous versions, versions of /a/b.txt are files of /.versions/a/b.txt
+const versionsRoot = "/.versions"
+
+// FileVersion - previous version of remote file
+type FileVersion struct {
+	// VersionID - unix time in nanoseconds when the version was replaced
+	VersionID string `json:"version_id"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	Hash      string `json:"hash"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// VersionPolicy - retention of versions used by PruneVersions
+type VersionPolicy struct {
+	// KeepCount - newest versions kept per file, 0 keeps all
+	KeepCount int `json:"keep_count,omitempty"`
+	// MaxAge - versions older than MaxAge seconds are removed, 0 keeps all
+	MaxAge int64 `json:"max_age,omitempty"`
+}
+
+var (
+	versioningMu      sync.Mutex
+	versioningEnabled bool
+)
+
+// SetVersioning - keep previous version of file updated by UpdateFile, EncryptAndUpdateFile, their thumbnail
+// variants, Put and WriteBytes. Version is saved once the update starts, before its data is sent.
+func (s *StorageSDK) SetVersioning(enabled bool) {
+	versioningMu.Lock()
+	defer versioningMu.Unlock()
+	versioningEnabled = enabled
+}
+
+func versioning() bool {
+	versioningMu.Lock()
+	defer versioningMu.Unlock()
+	return versioningEnabled
+}
+
+func versionsDir(remotePath string) string {
+	return path.Join(versionsRoot, path.Clean("/"+remotePath))
+}
+
+// ensureRemoteDir creates remote dir unless it exists
+func (a *Allocation) ensureRemoteDir(remoteDir string) error {
+	if remoteDir == "/" {
+		return nil
+	}
+	if _, err := a.remote().GetFileMeta(remoteDir); err == nil {
+		return nil
+	}
+	return a.remote().CreateDir(remoteDir)
+}
+
+// versionStatus saves version of remote file once its update is started. Sdk reports Started from the
+// goroutine sending the data right before the first chunk, so the content isn't replaced till the version
+// is saved, and updates failing to start don't save any. Update is cancelled when the version can't be saved.
+type versionStatus struct {
+	StatusCallback
+	a          *Allocation
+	localPath  string
+	remotePath string
+
+	mu  sync.Mutex
+	err error
+}
+
+// versionedUpdate returns callback of update from localPath, which keeps previous version when versioning is enabled
+func (a *Allocation) versionedUpdate(localPath, remotePath string, statusCb StatusCallback) StatusCallback {
+	if !versioning() {
+		return statusCb
+	}
+	return &versionStatus{StatusCallback: statusCb, a: a, localPath: localPath, remotePath: remotePath}
+}
+
+func (s *versionStatus) Started(allocationID, filePath string, op int, totalBytes int) {
+	if err := s.a.saveVersion(s.remotePath); err != nil {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		if err = s.a.sdkAllocation.CancelUpload(s.localPath); err != nil {
+			l.Logger.Error("failed to cancel update of ", s.remotePath, ": ", err)
+		}
+	}
+	s.StatusCallback.Started(allocationID, filePath, op, totalBytes)
+}
+
+// Error - update cancelled by versioning reports the versioning failure
+func (s *versionStatus) Error(allocationID string, filePath string, op int, err error) {
+	s.mu.Lock()
+	if s.err != nil {
+		err = s.err
+	}
+	s.mu.Unlock()
+	s.StatusCallback.Error(allocationID, filePath, op, err)
+}
+
+// saveVersion copies remote file into its versions dir before it's updated
+func (a *Allocation) saveVersion(remotePath string) error {
+	if !versioning() {
+		return nil
+	}
+	fileMeta, err := a.remote().GetFileMeta(remotePath)
+	if err != nil {
+		return err
+	}
+	// resumed or repeated update doesn't keep the same content twice
+	if versions, err := a.listVersions(remotePath); err == nil && len(versions) > 0 && versions[0].Hash == fileMeta.Hash {
+		return nil
+	}
+	if err := a.copyToVersions(remotePath); err != nil {
+		return fmt.Errorf("failed to save version of %s. %v", remotePath, err)
+	}
+	return nil
+}
+
+func (a *Allocation) copyToVersions(remotePath string) error {
+	dir := versionsDir(remotePath)
+	if err := a.ensureRemoteDir(dir); err != nil {
+		return err
+	}
+	if err := a.remote().CopyObject(remotePath, dir); err != nil {
+		return err
+	}
+	// copy keeps the name, it's renamed to version id right away
+	copied := path.Join(dir, path.Base(remotePath))
+	if err := a.remote().RenameObject(copied, strconv.FormatInt(time.Now().UnixNano(), 10)); err != nil {
+		a.remote().DeleteFile(copied)
+		return err
+	}
+	return nil
+}
+
+func (a *Allocation) listVersions(remotePath string) ([]*FileVersion, error) {
+	listResult, err := a.remote().ListDir(versionsDir(remotePath))
+	if err != nil {
+		return nil, err
+	}
+	return versionsOf(listResult), nil
+}
+
+// versionsOf returns versions kept in versions dir, newest first
+func versionsOf(listResult *sdk.ListResult) []*FileVersion {
+	versions := make([]*FileVersion, 0, len(listResult.Children))
+	for _, child := range listResult.Children {
+		if child.Type == "d" {
+			continue
+		}
+		nanos, err := strconv.ParseInt(child.Name, 10, 64)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, &FileVersion{
+			VersionID: child.Name,
+			Path:      child.Path,
+			Size:      child.ActualSize,
+			Hash:      child.Hash,
+			CreatedAt: nanos / int64(time.Second),
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].VersionID > versions[j].VersionID
+	})
+	return versions
+}
+
+// ListVersions - list previous versions of remote file, newest first. Returns FileVersion list JSON.
+func (a *Allocation) ListVersions(remotePath string) (string, error) {
+	versions, err := a.listVersions(remotePath)
+	if err != nil {
+		return "", err
+	}
+	retBytes, err := json.Marshal(versions)
+	if err != nil {
+		return "", err
+	}
+	return string(retBytes), nil
+}
+
+// RestoreVersion - replace remote file with its previous version, the replaced content is kept as a new version.
+// The version is copied next to the file under a temporary name first, the file is replaced only once the copy
+// is in place. Sdk can't rename over existing file, so the file is missing between its delete and the final rename;
+// when the rename fails, the restored content is left under the temporary name.
+func (a *Allocation) RestoreVersion(remotePath, versionID string) error {
+	remotePath = path.Clean("/" + remotePath)
+	versionPath := path.Join(versionsDir(remotePath), versionID)
+	if _, err := a.remote().GetFileMeta(versionPath); err != nil {
+		return fmt.Errorf("version %s of %s not found. %v", versionID, remotePath, err)
+	}
+	parent := path.Dir(remotePath)
+	if err := a.ensureRemoteDir(parent); err != nil {
+		return err
+	}
+	// copy keeps the name of the version, it's renamed to the temporary name right away
+	copied := path.Join(parent, versionID)
+	if _, err := a.remote().GetFileMeta(copied); err == nil {
+		return fmt.Errorf("can't restore version of %s, %s exists", remotePath, copied)
+	}
+	if err := a.remote().CopyObject(versionPath, parent); err != nil {
+		return err
+	}
+	tmpName := fmt.Sprintf(".%s.restore-%s", path.Base(remotePath), versionID)
+	if err := a.remote().RenameObject(copied, tmpName); err != nil {
+		a.remote().DeleteFile(copied)
+		return err
+	}
+	tmpPath := path.Join(parent, tmpName)
+	if _, err := a.remote().GetFileMeta(remotePath); err == nil {
+		if err = a.copyToVersions(remotePath); err != nil {
+			a.remote().DeleteFile(tmpPath)
+			return fmt.Errorf("failed to save version of %s. %v", remotePath, err)
+		}
+		if err = a.remote().DeleteFile(remotePath); err != nil {
+			a.remote().DeleteFile(tmpPath)
+			return err
+		}
+	}
+	if err := a.remote().RenameObject(tmpPath, path.Base(remotePath)); err != nil {
+		return fmt.Errorf("failed to move restored version from %s to %s. %v", tmpPath, remotePath, err)
+	}
+	return nil
+}
+
+// PruneVersions - remove versions of all files exceeding policy, policy is VersionPolicy JSON.
+// Returns number of removed versions.
+func (a *Allocation) PruneVersions(policy string) (int, error) {
+	p := &VersionPolicy{}
+	if err := json.Unmarshal([]byte(policy), p); err != nil {
+		return 0, fmt.Errorf("invalid version policy JSON. %v", err)
+	}
+	if p.KeepCount < 0 || p.MaxAge < 0 {
+		return 0, fmt.Errorf("invalid version policy %s", policy)
+	}
+	if _, err := a.remote().GetFileMeta(versionsRoot); err != nil {
+		// nothing was versioned yet
+		return 0, nil
+	}
+	return a.pruneVersionsDir(versionsRoot, p, time.Now().Add(-time.Duration(p.MaxAge)*time.Second).UnixNano())
+}
+
+func (a *Allocation) pruneVersionsDir(dir string, p *VersionPolicy, oldest int64) (int, error) {
+	listResult, err := a.remote().ListDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, child := range listResult.Children {
+		if child.Type != "d" {
+			continue
+		}
+		n, err := a.pruneVersionsDir(child.Path, p, oldest)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	for i, v := range versionsOf(listResult) {
+		nanos, _ := strconv.ParseInt(v.VersionID, 10, 64)
+		if (p.KeepCount == 0 || i < p.KeepCount) && (p.MaxAge == 0 || nanos >= oldest) {
+			continue
+		}
+		if err = a.remote().DeleteFile(v.Path); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,292 @@
+package zbox
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+// testRemoteFile - file or dir of testRemoteFiles
+type testRemoteFile struct {
+	dir  bool
+	size int64
+	hash string
+}
+
+// testRemoteFiles - in-memory remote tree following sdk semantics used by versions and trash
+type testRemoteFiles struct {
+	mu    sync.Mutex
+	files map[string]*testRemoteFile
+	// fail - errors returned by operations, keyed by "<operation> <path>"
+	fail map[string]error
+	// calls - number of calls by operation
+	calls map[string]int
+}
+
+func newTestRemoteFiles() *testRemoteFiles {
+	return &testRemoteFiles{
+		files: map[string]*testRemoteFile{"/": {dir: true}},
+		fail:  make(map[string]error),
+		calls: make(map[string]int),
+	}
+}
+
+func (f *testRemoteFiles) mkdirs(p string) {
+	for ; p != "/"; p = path.Dir(p) {
+		if _, ok := f.files[p]; !ok {
+			f.files[p] = &testRemoteFile{dir: true}
+		}
+	}
+}
+
+func (f *testRemoteFiles) addFile(p string, size int64, hash string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mkdirs(path.Dir(p))
+	f.files[p] = &testRemoteFile{size: size, hash: hash}
+}
+
+func (f *testRemoteFiles) get(p string) *testRemoteFile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.files[p]
+}
+
+func (f *testRemoteFiles) callCount(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+// paths returns sorted paths of the tree
+func (f *testRemoteFiles) paths() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var paths []string
+	for p := range f.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// call counts the operation and returns its injected failure
+func (f *testRemoteFiles) call(op, p string) error {
+	f.calls[op]++
+	return f.fail[op+" "+p]
+}
+
+func (f *testRemoteFiles) tree(p string) []string {
+	var paths []string
+	for q := range f.files {
+		if q == p || strings.HasPrefix(q, p+"/") {
+			paths = append(paths, q)
+		}
+	}
+	return paths
+}
+
+func (f *testRemoteFiles) copyTree(src, dst string) error {
+	if _, ok := f.files[src]; !ok {
+		return fmt.Errorf("%s not found", src)
+	}
+	if _, ok := f.files[dst]; ok {
+		return fmt.Errorf("%s exists", dst)
+	}
+	for _, q := range f.tree(src) {
+		e := *f.files[q]
+		f.files[dst+strings.TrimPrefix(q, src)] = &e
+	}
+	return nil
+}
+
+func (f *testRemoteFiles) GetFileMeta(p string) (*sdk.ConsolidatedFileMeta, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("GetFileMeta", p); err != nil {
+		return nil, err
+	}
+	e, ok := f.files[p]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", p)
+	}
+	meta := &sdk.ConsolidatedFileMeta{Name: path.Base(p), Path: p, Type: "f", Size: e.size, ActualFileSize: e.size, Hash: e.hash}
+	if e.dir {
+		meta.Type = "d"
+	}
+	return meta, nil
+}
+
+func (f *testRemoteFiles) ListDir(p string) (*sdk.ListResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("ListDir", p); err != nil {
+		return nil, err
+	}
+	if e, ok := f.files[p]; !ok || !e.dir {
+		return nil, fmt.Errorf("%s is not a dir", p)
+	}
+	result := &sdk.ListResult{Name: path.Base(p), Path: p, Type: "d"}
+	for q, e := range f.files {
+		if q == "/" || path.Dir(q) != p {
+			continue
+		}
+		child := &sdk.ListResult{Name: path.Base(q), Path: q, Type: "f", Size: e.size, ActualSize: e.size, Hash: e.hash}
+		if e.dir {
+			child.Type = "d"
+		}
+		result.Children = append(result.Children, child)
+	}
+	sort.Slice(result.Children, func(i, j int) bool {
+		return result.Children[i].Name < result.Children[j].Name
+	})
+	return result, nil
+}
+
+func (f *testRemoteFiles) CreateDir(p string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CreateDir", p); err != nil {
+		return err
+	}
+	f.mkdirs(p)
+	return nil
+}
+
+func (f *testRemoteFiles) CopyObject(p string, destPath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CopyObject", p); err != nil {
+		return err
+	}
+	if e, ok := f.files[destPath]; !ok || !e.dir {
+		return fmt.Errorf("%s is not a dir", destPath)
+	}
+	return f.copyTree(p, path.Join(destPath, path.Base(p)))
+}
+
+func (f *testRemoteFiles) MoveObject(p string, destPath string) error {
+	if err := f.CopyObject(p, destPath); err != nil {
+		return err
+	}
+	return f.DeleteFile(p)
+}
+
+func (f *testRemoteFiles) RenameObject(p string, destName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("RenameObject", p); err != nil {
+		return err
+	}
+	if err := f.copyTree(p, path.Join(path.Dir(p), destName)); err != nil {
+		return err
+	}
+	for _, q := range f.tree(p) {
+		delete(f.files, q)
+	}
+	return nil
+}
+
+func (f *testRemoteFiles) DeleteFile(p string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DeleteFile", p); err != nil {
+		return err
+	}
+	if _, ok := f.files[p]; !ok {
+		return fmt.Errorf("%s not found", p)
+	}
+	for _, q := range f.tree(p) {
+		delete(f.files, q)
+	}
+	return nil
+}
+
+func TestVersionsOf(t *testing.T) {
+	listResult := &sdk.ListResult{Children: []*sdk.ListResult{
+		{Name: "1600000000000000000", Path: "/.versions/a.txt/1600000000000000000", Type: "f", ActualSize: 10, Hash: "old"},
+		{Name: "1700000000000000000", Path: "/.versions/a.txt/1700000000000000000", Type: "f", ActualSize: 20, Hash: "new"},
+		{Name: "notes.txt", Path: "/.versions/a.txt/notes.txt", Type: "f"},
+		{Name: "1800000000000000000", Path: "/.versions/a.txt/1800000000000000000", Type: "d"},
+	}}
+	versions := versionsOf(listResult)
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(versions))
+	}
+	newest, oldest := versions[0], versions[1]
+	if newest.VersionID != "1700000000000000000" || newest.Hash != "new" || newest.Size != 20 || newest.CreatedAt != 1700000000 {
+		t.Fatalf("unexpected newest version %+v", newest)
+	}
+	if oldest.VersionID != "1600000000000000000" || oldest.Path != "/.versions/a.txt/1600000000000000000" {
+		t.Fatalf("unexpected oldest version %+v", oldest)
+	}
+	if len(versionsOf(&sdk.ListResult{})) != 0 {
+		t.Fatal("expected no versions of empty listing")
+	}
+}
+
+func TestHiddenPaths(t *testing.T) {
+	listResult := &sdk.ListResult{Path: "/", Children: []*sdk.ListResult{
+		{Name: ".versions", Path: "/.versions", Type: "d"},
+		{Name: ".trash", Path: "/.trash", Type: "d"},
+		{Name: ".compression", Path: "/.compression", Type: "d"},
+		{Name: ".versions-backup", Path: "/.versions-backup", Type: "d"},
+		{Name: "a.txt", Path: "/a.txt", Type: "f"},
+	}}
+	withoutHidden(listResult)
+	if len(listResult.Children) != 2 || listResult.Children[0].Name != ".versions-backup" || listResult.Children[1].Name != "a.txt" {
+		t.Fatalf("unexpected children %+v", listResult.Children)
+	}
+	if !isHiddenPath(".trash/1_x/b.txt") || isHiddenPath("/docs/.trash") {
+		t.Fatal("unexpected hidden path check")
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	files := newTestRemoteFiles()
+	a := &Allocation{ID: "alloc", files: files}
+	files.addFile("/docs/a.txt", 20, "new")
+	files.addFile("/.versions/docs/a.txt/1600000000000000000", 10, "old")
+
+	if err := a.RestoreVersion("/docs/a.txt", "1600000000000000000"); err != nil {
+		t.Fatal(err)
+	}
+	if f := files.get("/docs/a.txt"); f == nil || f.hash != "old" {
+		t.Fatalf("expected restored content, got %+v", f)
+	}
+	versions, err := a.listVersions("/docs/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Hash != "new" || versions[1].Hash != "old" {
+		t.Fatalf("expected replaced content kept as newest version, got %+v", versions)
+	}
+	for _, p := range files.paths() {
+		if strings.Contains(p, ".restore-") {
+			t.Fatalf("temporary copy %s left", p)
+		}
+	}
+}
+
+func TestRestoreVersionKeepsFileWhenCopyFails(t *testing.T) {
+	files := newTestRemoteFiles()
+	a := &Allocation{ID: "alloc", files: files}
+	files.addFile("/a.txt", 20, "new")
+	files.addFile("/.versions/a.txt/1600000000000000000", 10, "old")
+	files.fail["CopyObject /.versions/a.txt/1600000000000000000"] = fmt.Errorf("copy failed")
+
+	if err := a.RestoreVersion("/a.txt", "1600000000000000000"); err == nil {
+		t.Fatal("expected restore to fail")
+	}
+	if f := files.get("/a.txt"); f == nil || f.hash != "new" {
+		t.Fatalf("expected live file to be kept, got %+v", f)
+	}
+	if n := files.callCount("DeleteFile"); n != 0 {
+		t.Fatalf("expected nothing deleted, got %d deletes", n)
+	}
+}
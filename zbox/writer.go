@@ -0,0 +1,357 @@
+package zbox
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/0chain/gosdk/zboxcore/sdk"
+)
+
+// bytes of downloaded file sdk reads back to detect mime type
+const mimeSniffSize = 261
+
+// bytes passed to host writer at once
+const hostWriteSize = 64 * 1024
+
+// Writer - sink implemented by the host app, e.g. memory buffer or MediaStore entry
+type Writer interface {
+	Write(data []byte) error
+}
+
+// writerDownload - sdk downloads into named pipe which is drained into host writer,
+// so decrypted content is never stored on disk.
+//
+// It relies on internals of gosdk download worker, not on its API, pinned by writer_test.go:
+//   - download call refuses existing local path, the worker opens it for writing without O_EXCL
+//     only after file ref is fetched from blobbers, so pipe linked after the call is opened by it
+//   - after the last block the file is closed, opened again read-only and its first 261 bytes
+//     are read back by a single read for mime type detection before Completed is reported
+type writerDownload struct {
+	pipePath string
+	writer   Writer
+	size     int64
+	pipe     *os.File
+	// drained is closed once the content is read from the pipe and written
+	drained chan struct{}
+	// resolveRecord looks up compression record of the content, nil when records can't be read
+	resolveRecord func() (*compressionRecord, error)
+	record        *compressionRecord
+	// plainHead - head of decompressed content for mime type
+	plainHead []byte
+
+	mu       sync.Mutex
+	writeErr error
+	// pipeErr - pipe couldn't be linked, the download is cancelled
+	pipeErr error
+	// complete is set once whole content is read from the pipe
+	complete bool
+}
+
+// linkPipe links the pipe to download path
+var linkPipe = os.Link
+
+// writerStatus reports writer failure instead of cancellation caused by it
+type writerStatus struct {
+	StatusCallback
+	d *writerDownload
+}
+
+func (s *writerStatus) Error(allocationID string, filePath string, op int, err error) {
+	if perr := s.d.failure(); perr != nil {
+		err = perr
+	}
+	s.StatusCallback.Error(allocationID, filePath, op, err)
+}
+
+// Completed - decompressed content is reported instead of the stored one
+func (s *writerStatus) Completed(allocationID, filePath string, filename string, mimetype string, size int, op int) {
+	err := s.d.failure()
+	if err == nil && !s.d.isComplete() {
+		err = fmt.Errorf("failed to create download pipe. download finished before the pipe was linked")
+	}
+	if err != nil {
+		// sdk finished into its own file
+		s.StatusCallback.Error(allocationID, filePath, op, err)
+		return
+	}
+	if s.d.record != nil {
+		size, mimetype = int(s.d.record.Size), contentMimeType(s.d.plainHead)
+	}
+	s.StatusCallback.Completed(allocationID, filePath, filename, mimetype, size, op)
+}
+
+// InProgress - sdk reopens the pipe after the last block, it's held until the pipe is drained
+func (s *writerStatus) InProgress(allocationID, filePath string, op int, completedBytes int, data []byte) {
+	s.StatusCallback.InProgress(allocationID, filePath, op, completedBytes, data)
+	if int64(completedBytes) >= s.d.size {
+		<-s.d.drained
+	}
+}
+
+// DownloadToWriter - start download of remote file into host writer, compressed file is decompressed.
+// Data written before Error is reported has to be discarded by the host.
+func (a *Allocation) DownloadToWriter(remotePath string, writer Writer, statusCb StatusCallback) (*Operation, error) {
+	fileMeta, err := a.sdkAllocation.GetFileMeta(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	return a.downloadFileToWriter(fileMeta, writer, statusCb)
+}
+
+func (a *Allocation) downloadFileToWriter(fileMeta *sdk.ConsolidatedFileMeta, writer Writer, statusCb StatusCallback) (*Operation, error) {
+	resolveRecord := func() (*compressionRecord, error) {
+		return a.compressionRecord(fileMeta.Hash)
+	}
+	return a.downloadToWriter(fileMeta, writer, statusCb, resolveRecord, func(localPath string, cb StatusCallback) (*Operation, func() error) {
+		op := a.newDownloadOperation(fileMeta.Path, localPath, cb)
+		return op, func() error {
+			return a.sdkAllocation.DownloadFile(localPath, fileMeta.Path, op)
+		}
+	})
+}
+
+// DownloadFromAuthTicketToWriter - start download of shared file into host writer, shared compressed file
+// is written as stored. Data written before Error is reported has to be discarded by the host.
+func (a *Allocation) DownloadFromAuthTicketToWriter(authTicket string, remoteLookupHash string, remoteFilename string, rxPay bool, writer Writer, statusCb StatusCallback) (*Operation, error) {
+	fileMeta, err := a.sdkAllocation.GetFileMetaFromAuthTicket(authTicket, remoteLookupHash)
+	if err != nil {
+		return nil, err
+	}
+	return a.downloadToWriter(fileMeta, writer, statusCb, nil, func(localPath string, cb StatusCallback) (*Operation, func() error) {
+		op := a.newAuthTicketDownloadOperation(remoteLookupHash, remoteFilename, localPath, cb)
+		return op, func() error {
+			return a.sdkAllocation.DownloadFromAuthTicket(localPath, authTicket, remoteLookupHash, remoteFilename, rxPay, op)
+		}
+	})
+}
+
+// downloadToWriter starts download into the pipe, download verification doesn't apply as the content
+// can't be read back; sdk still compares content hash of the whole file before Completed is reported.
+// Compression record is looked up by drain, compressed content is decompressed while it's written.
+func (a *Allocation) downloadToWriter(fileMeta *sdk.ConsolidatedFileMeta, writer Writer, statusCb StatusCallback, resolveRecord func() (*compressionRecord, error), download func(localPath string, statusCb StatusCallback) (*Operation, func() error)) (*Operation, error) {
+	if writer == nil {
+		return nil, fmt.Errorf("writer is required")
+	}
+	if fileMeta.Size == 0 {
+		// sdk would block reading mime type from the empty pipe
+		op := a.newOperation(OpTypeDownload, "", fileMeta.Path, statusCb)
+		go func() {
+			op.Started(a.ID, fileMeta.Path, sdk.OpDownload, 0)
+			op.Completed(a.ID, fileMeta.Path, fileMeta.Name, fileMeta.MimeType, 0, sdk.OpDownload)
+		}()
+		return op, nil
+	}
+	dir, err := newSpoolDir("download")
+	if err != nil {
+		return nil, err
+	}
+	d := &writerDownload{
+		pipePath: filepath.Join(dir, "download"),
+		writer:   writer,
+		size:     fileMeta.Size,
+		drained:  make(chan struct{}),
+
+		resolveRecord: resolveRecord,
+	}
+	fifoPath := filepath.Join(dir, "pipe")
+	if err = makeFifo(fifoPath); err == nil {
+		// read-write open doesn't block and keeps the pipe open between sdk opens
+		d.pipe, err = os.OpenFile(fifoPath, os.O_RDWR, 0)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create download pipe. %v", err)
+	}
+	w := newStatusWaiter(&writerStatus{StatusCallback: statusCb, d: d})
+	op, call := download(d.pipePath, w)
+	// sdk refuses existing local paths, so the pipe is linked once sdk call checked the path,
+	// operations waiting for another transfer of the same file call sdk later
+	started, err := op.start(func() error {
+		if err := call(); err != nil {
+			return err
+		}
+		d.link(fifoPath, op)
+		return nil
+	})
+	if err != nil {
+		d.pipe.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	go func() {
+		w.wait()
+		d.pipe.Close()
+		os.RemoveAll(dir)
+	}()
+	return started, nil
+}
+
+// link links the pipe to download path and drains it. Link fails when sdk created the file first,
+// the download is cancelled then and the failure is reported to status callback, sdk writes at most
+// one batch of blocks to its file in the private dir before it stops.
+func (d *writerDownload) link(fifoPath string, op *Operation) {
+	if err := linkPipe(fifoPath, d.pipePath); err != nil {
+		d.mu.Lock()
+		d.pipeErr = fmt.Errorf("failed to create download pipe. %v", err)
+		d.mu.Unlock()
+		close(d.drained)
+		op.Cancel()
+		return
+	}
+	go d.drain(op)
+}
+
+// drain passes file content to the writer, pipe is drained even after writer failure so sdk isn't blocked
+func (d *writerDownload) drain(op *Operation) {
+	defer close(d.drained)
+	var out io.Writer = &writerAdapter{w: d.writer}
+	if d.resolveRecord != nil {
+		record, err := d.resolveRecord()
+		if err != nil {
+			d.fail(fmt.Errorf("failed to look up compression. %v", err), op)
+		}
+		d.record = record
+	}
+	var pw *io.PipeWriter
+	decompressed := make(chan struct{})
+	if d.record != nil {
+		var pr *io.PipeReader
+		pr, pw = io.Pipe()
+		out = pw
+		go func() {
+			defer close(decompressed)
+			err := d.decompress(pr)
+			if err != nil {
+				d.fail(err, op)
+			}
+			// stored bytes left after failure are discarded
+			pr.CloseWithError(err)
+		}()
+	} else {
+		close(decompressed)
+	}
+
+	head := make([]byte, 0, mimeSniffSize)
+	buf := make([]byte, hostWriteSize)
+	var read int64
+	for read < d.size {
+		size := int64(len(buf))
+		if d.size-read < size {
+			size = d.size - read
+		}
+		n, err := d.pipe.Read(buf[:size])
+		if n > 0 {
+			read += int64(n)
+			if len(head) < cap(head) {
+				rest := cap(head) - len(head)
+				if n < rest {
+					rest = n
+				}
+				head = append(head, buf[:rest]...)
+			}
+			d.write(out, buf[:n], op)
+		}
+		if err != nil {
+			// pipe is closed once download failed
+			break
+		}
+	}
+	if pw != nil {
+		pw.Close()
+	}
+	<-decompressed
+	if read < d.size {
+		return
+	}
+	d.mu.Lock()
+	d.complete = true
+	d.mu.Unlock()
+	// sdk reads head of the file back for mime type
+	d.pipe.Write(head)
+}
+
+// decompress writes decompressed content to the writer and checks its hash
+func (d *writerDownload) decompress(r io.Reader) error {
+	rc, err := d.record.codec().decompress(r)
+	if err != nil {
+		return fmt.Errorf("failed to decompress content. %v", err)
+	}
+	defer rc.Close()
+	h := sha1.New()
+	buf := make([]byte, hostWriteSize)
+	for {
+		n, err := rc.Read(buf)
+		if n > 0 {
+			if len(d.plainHead) < mimeSniffSize {
+				rest := mimeSniffSize - len(d.plainHead)
+				if n < rest {
+					rest = n
+				}
+				d.plainHead = append(d.plainHead, buf[:rest]...)
+			}
+			h.Write(buf[:n])
+			if werr := d.writer.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decompress content. %v", err)
+		}
+	}
+	if hash := hex.EncodeToString(h.Sum(nil)); hash != d.record.PlainHash {
+		return fmt.Errorf("decompressed content hash %s doesn't match %s", hash, d.record.PlainHash)
+	}
+	return nil
+}
+
+func (d *writerDownload) write(out io.Writer, data []byte, op *Operation) {
+	d.mu.Lock()
+	failed := d.writeErr != nil
+	d.mu.Unlock()
+	if failed {
+		return
+	}
+	if _, err := out.Write(data); err != nil {
+		d.fail(err, op)
+	}
+}
+
+// failure returns error reported instead of sdk result
+func (d *writerDownload) failure() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pipeErr != nil {
+		return d.pipeErr
+	}
+	if d.writeErr != nil {
+		return fmt.Errorf("failed to write downloaded data. %v", d.writeErr)
+	}
+	return nil
+}
+
+func (d *writerDownload) isComplete() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.complete
+}
+
+// fail keeps the first failure and cancels the download
+func (d *writerDownload) fail(err error, op *Operation) {
+	d.mu.Lock()
+	failed := d.writeErr != nil
+	if !failed {
+		d.writeErr = err
+	}
+	d.mu.Unlock()
+	if !failed {
+		op.Cancel()
+	}
+}
@@ -0,0 +1,223 @@
+//go:build !windows && !race
+// +build !windows,!race
+
+package zbox
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	"github.com/0chain/gosdk/zboxcore/encoder"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/sdk"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+)
+
+// testWriter collects written data
+type testWriter struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (w *testWriter) Write(data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.data = append(w.data, data...)
+	return nil
+}
+
+func (w *testWriter) bytes() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]byte(nil), w.data...)
+}
+
+// testDownloadResult - final status of a download
+type testDownloadResult struct {
+	mimetype string
+	size     int
+	err      error
+}
+
+type testDownloadCallback struct {
+	done chan testDownloadResult
+}
+
+func (cb *testDownloadCallback) Started(allocationID, filePath string, op int, totalBytes int) {}
+func (cb *testDownloadCallback) InProgress(allocationID, filePath string, op int, completedBytes int, data []byte) {
+}
+func (cb *testDownloadCallback) CommitMetaCompleted(request, response string, err error) {}
+func (cb *testDownloadCallback) RepairCompleted(filesRepaired int)                       {}
+func (cb *testDownloadCallback) Completed(allocationID, filePath string, filename string, mimetype string, size int, op int) {
+	cb.done <- testDownloadResult{mimetype: mimetype, size: size}
+}
+func (cb *testDownloadCallback) Error(allocationID string, filePath string, op int, err error) {
+	cb.done <- testDownloadResult{err: err}
+}
+
+func (cb *testDownloadCallback) wait(t *testing.T) testDownloadResult {
+	select {
+	case r := <-cb.done:
+		return r
+	case <-time.After(30 * time.Second):
+		t.Fatal("download didn't finish")
+	}
+	return testDownloadResult{}
+}
+
+// newTestSdkAllocation initializes sdk with fake network and blobbers serving erasure coded content
+// of remotePath the way blobbers do, so the download runs through the vendored sdk download worker.
+// The worker has data races of its own, so these tests are built without race detector.
+func newTestSdkAllocation(t *testing.T, remotePath string, content []byte) (*Allocation, func()) {
+	network := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"miners":["http://miner"],"sharders":["http://sharder"]}`)
+	}))
+	if err := sdk.InitStorageSDK(`{"client_id":"client","client_key":"key"}`, network.URL, "chain", "bls0chain", nil); err != nil {
+		network.Close()
+		t.Fatal(err)
+	}
+	e, err := encoder.NewEncoder(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards, err := e.Encode(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha1.Sum(content)
+	ref := &fileref.FileRef{
+		Ref:            fileref.Ref{Type: fileref.FILE, Name: filepath.Base(remotePath), Path: remotePath},
+		ActualFileSize: int64(len(content)),
+		ActualFileHash: hex.EncodeToString(h[:]),
+	}
+	meta, err := json.Marshal(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers := []*httptest.Server{network}
+	var blobbers []*blockchain.StorageNode
+	for i, shard := range shards {
+		shard := shard
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case strings.Contains(r.URL.Path, zboxutil.FILE_META_ENDPOINT):
+				w.Write(meta)
+			case strings.Contains(r.URL.Path, zboxutil.DOWNLOAD_ENDPOINT):
+				w.Write(shard)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		servers = append(servers, srv)
+		blobbers = append(blobbers, &blockchain.StorageNode{ID: fmt.Sprintf("blobber%d", i), Baseurl: srv.URL})
+	}
+	sa := &sdk.Allocation{ID: "writer-alloc", Tx: "writer-tx", DataShards: 2, ParityShards: 1, Blobbers: blobbers}
+	sa.InitAllocation()
+	a := &Allocation{ID: sa.ID, sdkAllocation: sa}
+	return a, func() {
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}
+}
+
+// testPNG - content sdk detects as png from its head
+func testPNG() []byte {
+	content := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	for i := 0; len(content) < 5000; i++ {
+		content = append(content, byte(i*7))
+	}
+	return content
+}
+
+func TestDownloadToWriterThroughSdkWorker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	content := testPNG()
+	a, closeBlobbers := newTestSdkAllocation(t, "/photo.png", content)
+	defer closeBlobbers()
+
+	// download call refuses existing local path, so the pipe can't be linked before it
+	existing := filepath.Join(dir, "existing")
+	if err = ioutil.WriteFile(existing, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.sdkAllocation.DownloadFile(existing, "/photo.png", nil); err == nil {
+		t.Fatal("expected sdk to refuse existing local path")
+	}
+
+	writer := &testWriter{}
+	cb := &testDownloadCallback{done: make(chan testDownloadResult, 1)}
+	fileMeta := &sdk.ConsolidatedFileMeta{Name: "photo.png", Path: "/photo.png", Size: int64(len(content))}
+	if _, err = a.downloadFileToWriter(fileMeta, writer, cb); err != nil {
+		t.Fatal(err)
+	}
+	r := cb.wait(t)
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if !bytes.Equal(writer.bytes(), content) {
+		t.Fatalf("expected %d bytes of content, got %d", len(content), len(writer.bytes()))
+	}
+	// sdk detects mime type from the head written back to the pipe
+	if r.mimetype != "image/png" || r.size != len(content) {
+		t.Fatalf("expected image/png of %d bytes, got %s of %d", len(content), r.mimetype, r.size)
+	}
+}
+
+func TestDownloadToWriterFailsWhenSdkCreatesFileFirst(t *testing.T) {
+	content := testPNG()
+	a, closeBlobbers := newTestSdkAllocation(t, "/race.png", content)
+	defer closeBlobbers()
+
+	var downloadDir string
+	linkPipe = func(oldname, newname string) error {
+		downloadDir = filepath.Dir(newname)
+		// let sdk worker create the file first
+		for i := 0; i < 500; i++ {
+			if _, err := os.Stat(newname); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return os.Link(oldname, newname)
+	}
+	defer func() { linkPipe = os.Link }()
+
+	writer := &testWriter{}
+	cb := &testDownloadCallback{done: make(chan testDownloadResult, 1)}
+	fileMeta := &sdk.ConsolidatedFileMeta{Name: "race.png", Path: "/race.png", Size: int64(len(content))}
+	if _, err := a.downloadFileToWriter(fileMeta, writer, cb); err != nil {
+		t.Fatal(err)
+	}
+	r := cb.wait(t)
+	if r.err == nil || !strings.Contains(r.err.Error(), "download pipe") {
+		t.Fatalf("expected pipe failure, got %v", r.err)
+	}
+	if n := len(writer.bytes()); n != 0 {
+		t.Fatalf("expected nothing written, got %d bytes", n)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(downloadDir); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expected download dir to be removed")
+}